@@ -0,0 +1,44 @@
+package bus
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrTicketNotFound 票据不存在、已过期或已被使用
+var ErrTicketNotFound = errors.New("ticket not found")
+
+// Handler 处理订阅到的一条消息，同一频道的消息按到达顺序依次调用
+type Handler func(payload []byte)
+
+// Bus 节点间的发布订阅通道
+type Bus interface {
+	// Publish 向频道发布消息，所有订阅了该频道的节点（包括自己）都会收到
+	Publish(channel string, payload []byte) error
+	// Subscribe 订阅频道，同一频道可以注册多个处理函数
+	Subscribe(channel string, handler Handler) error
+	Close() error
+}
+
+// Registry 记录每个用户的连接分布在哪些节点上，用于把消息路由到正确的节点
+type Registry interface {
+	// Add 用户在节点上有了第一个连接
+	Add(userID, nodeID string) error
+	// Remove 用户在节点上的最后一个连接断开
+	Remove(userID, nodeID string) error
+	// Locate 批量查询用户有连接且仍然存活的节点，没有任何连接的用户不出现在结果中。
+	// 一次推送的全部接收者合并为一次查询，实现应避免逐个用户往返
+	Locate(userIDs []string) (map[string][]string, error)
+	// KeepAlive 刷新节点的存活标记，超过 ttl 未刷新的节点会被 Locate 忽略
+	KeepAlive(nodeID string, ttl time.Duration) error
+	// ResetNode 清除节点的全部记录，节点启动时调用以清理上次运行残留
+	ResetNode(nodeID string) error
+}
+
+// TicketStore 一次性票据的存储，多节点部署时必须共享：票据可能由一个节点签发、在另一个节点上使用
+type TicketStore interface {
+	// Issue 保存票据，ttl 后自动失效
+	Issue(ticket string, value []byte, ttl time.Duration) error
+	// Consume 取出并删除票据，同一票据只有一次调用能成功，其余返回 ErrTicketNotFound
+	Consume(ticket string) ([]byte, error)
+}
@@ -0,0 +1,138 @@
+package bus
+
+import (
+	"sync"
+	"time"
+)
+
+// MemoryBus 进程内的发布订阅，单节点部署使用；多个 WSManager 共用一个实例时可以模拟多节点
+type MemoryBus struct {
+	mu       sync.RWMutex
+	handlers map[string][]Handler
+}
+
+func NewMemoryBus() *MemoryBus {
+	return &MemoryBus{handlers: make(map[string][]Handler)}
+}
+
+func (b *MemoryBus) Publish(channel string, payload []byte) error {
+	b.mu.RLock()
+	handlers := append([]Handler(nil), b.handlers[channel]...)
+	b.mu.RUnlock()
+
+	for _, handler := range handlers {
+		handler(payload)
+	}
+	return nil
+}
+
+func (b *MemoryBus) Subscribe(channel string, handler Handler) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers[channel] = append(b.handlers[channel], handler)
+	return nil
+}
+
+func (b *MemoryBus) Close() error {
+	return nil
+}
+
+// MemoryRegistry 进程内的连接位置表，同一进程内的节点始终视为存活
+type MemoryRegistry struct {
+	mu    sync.Mutex
+	nodes map[string]map[string]struct{} // user -> nodes
+}
+
+func NewMemoryRegistry() *MemoryRegistry {
+	return &MemoryRegistry{nodes: make(map[string]map[string]struct{})}
+}
+
+func (r *MemoryRegistry) Add(userID, nodeID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.nodes[userID] == nil {
+		r.nodes[userID] = make(map[string]struct{})
+	}
+	r.nodes[userID][nodeID] = struct{}{}
+	return nil
+}
+
+func (r *MemoryRegistry) Remove(userID, nodeID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.nodes[userID], nodeID)
+	if len(r.nodes[userID]) == 0 {
+		delete(r.nodes, userID)
+	}
+	return nil
+}
+
+func (r *MemoryRegistry) Locate(userIDs []string) (map[string][]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	located := make(map[string][]string)
+	for _, userID := range userIDs {
+		for nodeID := range r.nodes[userID] {
+			located[userID] = append(located[userID], nodeID)
+		}
+	}
+	return located, nil
+}
+
+func (r *MemoryRegistry) KeepAlive(nodeID string, ttl time.Duration) error {
+	return nil
+}
+
+func (r *MemoryRegistry) ResetNode(nodeID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for userID, nodes := range r.nodes {
+		delete(nodes, nodeID)
+		if len(nodes) == 0 {
+			delete(r.nodes, userID)
+		}
+	}
+	return nil
+}
+
+// MemoryTicketStore 进程内的票据存储，只适用于单节点部署
+type MemoryTicketStore struct {
+	mu      sync.Mutex
+	tickets map[string]memoryTicket
+}
+
+type memoryTicket struct {
+	value     []byte
+	expiresAt time.Time
+}
+
+func NewMemoryTicketStore() *MemoryTicketStore {
+	return &MemoryTicketStore{tickets: make(map[string]memoryTicket)}
+}
+
+func (s *MemoryTicketStore) Issue(ticket string, value []byte, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// 顺便清理已过期的票据，避免 map 无限增长
+	now := time.Now()
+	for k, t := range s.tickets {
+		if now.After(t.expiresAt) {
+			delete(s.tickets, k)
+		}
+	}
+	s.tickets[ticket] = memoryTicket{value: value, expiresAt: now.Add(ttl)}
+	return nil
+}
+
+func (s *MemoryTicketStore) Consume(ticket string) ([]byte, error) {
+	s.mu.Lock()
+	t, ok := s.tickets[ticket]
+	delete(s.tickets, ticket)
+	s.mu.Unlock()
+
+	if !ok || time.Now().After(t.expiresAt) {
+		return nil, ErrTicketNotFound
+	}
+	return t.value, nil
+}
@@ -0,0 +1,44 @@
+package bus
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMemoryBus(t *testing.T) {
+	b := NewMemoryBus()
+	var got []string
+	b.Subscribe("ws:node:a", func(payload []byte) { got = append(got, "first "+string(payload)) })
+	b.Subscribe("ws:node:a", func(payload []byte) { got = append(got, "second "+string(payload)) })
+	b.Subscribe("ws:node:b", func(payload []byte) { got = append(got, "other "+string(payload)) })
+
+	if err := b.Publish("ws:node:a", []byte("x")); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"first x", "second x"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestMemoryRegistry(t *testing.T) {
+	r := NewMemoryRegistry()
+	r.Add("u1", "n1")
+	r.Add("u1", "n2")
+	r.Add("u2", "n2")
+
+	want := map[string][]string{"u1": {"n1", "n2"}, "u2": {"n2"}}
+	if got := sortedLocate(t, r, "u1", "u2", "u3"); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	r.Remove("u1", "n1")
+	r.ResetNode("n2")
+	if got := sortedLocate(t, r, "u1", "u2"); len(got) != 0 {
+		t.Errorf("after remove and reset: got %v, want none", got)
+	}
+}
+
+func TestMemoryTicketStore(t *testing.T) {
+	testTicketStore(t, NewMemoryTicketStore(), time.Sleep)
+}
@@ -0,0 +1,283 @@
+package bus
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisHandlerQueueSize 每个频道待处理消息的缓冲，处理函数跟不上时订阅读取最多积压这么多条
+const redisHandlerQueueSize = 1024
+
+// RedisBus 基于 Redis PUBLISH / SUBSCRIBE 的总线。
+// go-redis 负责断线重连和重新订阅；每个频道的消息由各自的协程按顺序交给处理函数，
+// 一个频道处理得慢不会拖住订阅连接和其他频道
+type RedisBus struct {
+	client *redis.Client
+	pubsub *redis.PubSub
+
+	mu     sync.Mutex
+	queues map[string]*redisChannelQueue
+	done   chan struct{}
+}
+
+// redisChannelQueue 一个频道的处理函数和待处理消息
+type redisChannelQueue struct {
+	mu       sync.Mutex
+	handlers []Handler
+	messages chan []byte
+}
+
+// NewRedisBus 连接 Redis 并启动订阅分发
+func NewRedisBus(addr, password string) (*RedisBus, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     addr,
+		Password: password,
+		// PUBLISH 不是幂等的：网络错误后重试可能让订阅者收到两次，失败直接返回给调用方
+		MaxRetries: -1,
+	})
+	ctx := context.Background()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, err
+	}
+	b := &RedisBus{
+		client: client,
+		pubsub: client.Subscribe(ctx),
+		queues: make(map[string]*redisChannelQueue),
+		done:   make(chan struct{}),
+	}
+	go b.dispatch()
+	return b, nil
+}
+
+func (b *RedisBus) Publish(channel string, payload []byte) error {
+	return b.client.Publish(context.Background(), channel, payload).Err()
+}
+
+func (b *RedisBus) Subscribe(channel string, handler Handler) error {
+	b.mu.Lock()
+	queue, exists := b.queues[channel]
+	if !exists {
+		queue = &redisChannelQueue{messages: make(chan []byte, redisHandlerQueueSize)}
+		b.queues[channel] = queue
+	}
+	b.mu.Unlock()
+
+	queue.mu.Lock()
+	queue.handlers = append(queue.handlers, handler)
+	queue.mu.Unlock()
+
+	if exists {
+		return nil
+	}
+	go b.consume(queue)
+	return b.pubsub.Subscribe(context.Background(), channel)
+}
+
+func (b *RedisBus) Close() error {
+	b.mu.Lock()
+	select {
+	case <-b.done:
+		b.mu.Unlock()
+		return nil
+	default:
+		close(b.done)
+	}
+	b.mu.Unlock()
+
+	err := b.pubsub.Close()
+	if closeErr := b.client.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// dispatch 把订阅收到的消息放进对应频道的队列，不在这里执行处理函数
+func (b *RedisBus) dispatch() {
+	for msg := range b.pubsub.Channel() {
+		b.mu.Lock()
+		queue := b.queues[msg.Channel]
+		b.mu.Unlock()
+		if queue == nil {
+			continue
+		}
+		select {
+		case queue.messages <- []byte(msg.Payload):
+		case <-b.done:
+			return
+		}
+	}
+}
+
+// consume 按到达顺序把一个频道的消息交给它的处理函数
+func (b *RedisBus) consume(queue *redisChannelQueue) {
+	for {
+		select {
+		case payload := <-queue.messages:
+			queue.mu.Lock()
+			handlers := append([]Handler(nil), queue.handlers...)
+			queue.mu.Unlock()
+			for _, handler := range handlers {
+				handler(payload)
+			}
+		case <-b.done:
+			return
+		}
+	}
+}
+
+// RedisRegistry 基于 Redis 集合的连接位置表：
+// ws:user:<user>:nodes 记录用户所在节点，ws:node:<node>:users 记录节点上的用户便于清理，
+// ws:node:<node>:alive 为节点存活标记
+type RedisRegistry struct {
+	client *redis.Client
+}
+
+func NewRedisRegistry(addr, password string) *RedisRegistry {
+	return &RedisRegistry{client: redis.NewClient(&redis.Options{Addr: addr, Password: password})}
+}
+
+func userNodesKey(userID string) string { return "ws:user:" + userID + ":nodes" }
+func nodeUsersKey(nodeID string) string { return "ws:node:" + nodeID + ":users" }
+func nodeAliveKey(nodeID string) string { return "ws:node:" + nodeID + ":alive" }
+
+func (r *RedisRegistry) Add(userID, nodeID string) error {
+	_, err := r.client.TxPipelined(context.Background(), func(pipe redis.Pipeliner) error {
+		pipe.SAdd(context.Background(), userNodesKey(userID), nodeID)
+		pipe.SAdd(context.Background(), nodeUsersKey(nodeID), userID)
+		return nil
+	})
+	return err
+}
+
+func (r *RedisRegistry) Remove(userID, nodeID string) error {
+	_, err := r.client.TxPipelined(context.Background(), func(pipe redis.Pipeliner) error {
+		pipe.SRem(context.Background(), userNodesKey(userID), nodeID)
+		pipe.SRem(context.Background(), nodeUsersKey(nodeID), userID)
+		return nil
+	})
+	return err
+}
+
+// Locate 固定两次往返：一次管道化的 SMEMBERS 取出所有用户的节点，一次 MGET 检查这些节点是否存活
+func (r *RedisRegistry) Locate(userIDs []string) (map[string][]string, error) {
+	located := make(map[string][]string)
+	if len(userIDs) == 0 {
+		return located, nil
+	}
+	ctx := context.Background()
+
+	members := make([]*redis.StringSliceCmd, len(userIDs))
+	_, err := r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, userID := range userIDs {
+			members[i] = pipe.SMembers(ctx, userNodesKey(userID))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var nodeIDs []string
+	seen := make(map[string]bool)
+	for i, cmd := range members {
+		nodes := cmd.Val()
+		if len(nodes) > 0 {
+			located[userIDs[i]] = nodes
+		}
+		for _, nodeID := range nodes {
+			if !seen[nodeID] {
+				seen[nodeID] = true
+				nodeIDs = append(nodeIDs, nodeID)
+			}
+		}
+	}
+	if len(nodeIDs) == 0 {
+		return located, nil
+	}
+
+	keys := make([]string, len(nodeIDs))
+	for i, nodeID := range nodeIDs {
+		keys[i] = nodeAliveKey(nodeID)
+	}
+	flags, err := r.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	alive := make(map[string]bool, len(nodeIDs))
+	for i, nodeID := range nodeIDs {
+		alive[nodeID] = flags[i] != nil
+	}
+
+	for userID, nodes := range located {
+		live := nodes[:0]
+		for _, nodeID := range nodes {
+			if alive[nodeID] {
+				live = append(live, nodeID)
+			}
+		}
+		if len(live) == 0 {
+			delete(located, userID)
+		} else {
+			located[userID] = live
+		}
+	}
+	return located, nil
+}
+
+func (r *RedisRegistry) KeepAlive(nodeID string, ttl time.Duration) error {
+	return r.client.Set(context.Background(), nodeAliveKey(nodeID), "1", ttl).Err()
+}
+
+func (r *RedisRegistry) ResetNode(nodeID string) error {
+	ctx := context.Background()
+	users, err := r.client.SMembers(ctx, nodeUsersKey(nodeID)).Result()
+	if err != nil {
+		return err
+	}
+	_, err = r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, userID := range users {
+			pipe.SRem(ctx, userNodesKey(userID), nodeID)
+		}
+		pipe.Del(ctx, nodeUsersKey(nodeID))
+		return nil
+	})
+	return err
+}
+
+// RedisTicketStore 基于 Redis 的票据存储：SET NX PX 签发，GETDEL 原子地取出并作废（需要 Redis 6.2+）
+type RedisTicketStore struct {
+	client *redis.Client
+}
+
+func NewRedisTicketStore(addr, password string) *RedisTicketStore {
+	return &RedisTicketStore{client: redis.NewClient(&redis.Options{Addr: addr, Password: password})}
+}
+
+func ticketKey(ticket string) string { return "ws:ticket:" + ticket }
+
+func (s *RedisTicketStore) Issue(ticket string, value []byte, ttl time.Duration) error {
+	ok, err := s.client.SetNX(context.Background(), ticketKey(ticket), value, ttl).Result()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("redis: ticket already exists")
+	}
+	return nil
+}
+
+func (s *RedisTicketStore) Consume(ticket string) ([]byte, error) {
+	value, err := s.client.GetDel(context.Background(), ticketKey(ticket)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrTicketNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return value, nil
+}
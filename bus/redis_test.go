@@ -0,0 +1,291 @@
+package bus
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// waitFor 轮询直到条件成立，超时则失败
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func receive(t *testing.T, ch <-chan string) string {
+	t.Helper()
+	select {
+	case payload := <-ch:
+		return payload
+	case <-time.After(3 * time.Second):
+		t.Fatal("timed out waiting for message")
+		return ""
+	}
+}
+
+func subscribed(server *miniredis.Miniredis, channels ...string) func() bool {
+	return func() bool {
+		counts := server.PubSubNumSub(channels...)
+		for _, channel := range channels {
+			if counts[channel] != 1 {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+func newTestRedisBus(t *testing.T, server *miniredis.Miniredis, password string) *RedisBus {
+	t.Helper()
+	b, err := NewRedisBus(server.Addr(), password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { b.Close() })
+	return b
+}
+
+func TestRedisBusPublishSubscribe(t *testing.T) {
+	server := miniredis.RunT(t)
+	server.RequireAuth("secret")
+	b := newTestRedisBus(t, server, "secret")
+
+	received := make(chan string, 10)
+	if err := b.Subscribe("ws:node:a", func(payload []byte) { received <- string(payload) }); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "subscription", subscribed(server, "ws:node:a"))
+
+	if err := b.Publish("ws:node:b", []byte(`{"kind":"other"}`)); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := b.Publish("ws:node:a", []byte{'0' + byte(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 同一频道按发布顺序处理
+	for i := 0; i < 3; i++ {
+		if got, want := receive(t, received), string([]byte{'0' + byte(i)}); got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	}
+	select {
+	case got := <-received:
+		t.Errorf("received message from unsubscribed channel: %q", got)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestRedisBusWrongPassword(t *testing.T) {
+	server := miniredis.RunT(t)
+	server.RequireAuth("secret")
+	if _, err := NewRedisBus(server.Addr(), "wrong"); err == nil {
+		t.Fatal("expected auth error")
+	}
+}
+
+func TestRedisBusSlowHandlerDoesNotBlockOtherChannels(t *testing.T) {
+	server := miniredis.RunT(t)
+	b := newTestRedisBus(t, server, "")
+
+	release := make(chan struct{})
+	defer close(release)
+	b.Subscribe("ws:node:a", func(payload []byte) { <-release })
+	received := make(chan string, 1)
+	b.Subscribe("ws:presence", func(payload []byte) { received <- string(payload) })
+	waitFor(t, "subscriptions", subscribed(server, "ws:node:a", "ws:presence"))
+
+	// ws:node:a 的处理函数一直阻塞，ws:presence 的消息照常处理
+	b.Publish("ws:node:a", []byte("stuck"))
+	b.Publish("ws:presence", []byte("online"))
+	if got := receive(t, received); got != "online" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestRedisBusResubscribesAfterRestart(t *testing.T) {
+	server := miniredis.RunT(t)
+	b := newTestRedisBus(t, server, "")
+
+	received := make(chan string, 10)
+	for _, channel := range []string{"ws:node:a", "ws:presence"} {
+		channel := channel
+		if err := b.Subscribe(channel, func(payload []byte) { received <- channel + " " + string(payload) }); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitFor(t, "subscriptions", subscribed(server, "ws:node:a", "ws:presence"))
+
+	// 重启会断开所有连接，订阅应自动恢复
+	server.Close()
+	if err := server.Restart(); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "resubscription", subscribed(server, "ws:node:a", "ws:presence"))
+
+	if err := b.Publish("ws:presence", []byte(`{"status":"online"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if got := receive(t, received); got != `ws:presence {"status":"online"}` {
+		t.Errorf("got %q", got)
+	}
+	if err := b.Publish("ws:node:a", []byte(`{}`)); err != nil {
+		t.Fatal(err)
+	}
+	if got := receive(t, received); got != `ws:node:a {}` {
+		t.Errorf("got %q", got)
+	}
+}
+
+func sortedLocate(t *testing.T, r Registry, userIDs ...string) map[string][]string {
+	t.Helper()
+	located, err := r.Locate(userIDs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, nodes := range located {
+		sort.Strings(nodes)
+	}
+	return located
+}
+
+func TestRedisRegistry(t *testing.T) {
+	server := miniredis.RunT(t)
+	r := NewRedisRegistry(server.Addr(), "")
+
+	for _, loc := range [][2]string{{"u1", "n1"}, {"u1", "n2"}, {"u2", "n2"}, {"u3", "n3"}} {
+		if err := r.Add(loc[0], loc[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, nodeID := range []string{"n1", "n2"} {
+		if err := r.KeepAlive(nodeID, time.Minute); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.KeepAlive("n3", 10*time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	before := server.CommandCount()
+	want := map[string][]string{"u1": {"n1", "n2"}, "u2": {"n2"}, "u3": {"n3"}}
+	if got := sortedLocate(t, r, "u1", "u2", "u3", "u4"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Locate: got %v, want %v", got, want)
+	}
+	// 每个用户一条 SMEMBERS（同一管道），存活检查合并为一条 MGET
+	if got := server.CommandCount() - before; got != 5 {
+		t.Errorf("Locate sent %d commands, want 5", got)
+	}
+
+	// 存活标记过期的节点被忽略
+	server.FastForward(11 * time.Second)
+	want = map[string][]string{"u1": {"n1", "n2"}, "u2": {"n2"}}
+	if got := sortedLocate(t, r, "u1", "u2", "u3"); !reflect.DeepEqual(got, want) {
+		t.Errorf("after n3 expired: got %v, want %v", got, want)
+	}
+
+	if err := r.Remove("u1", "n2"); err != nil {
+		t.Fatal(err)
+	}
+	want = map[string][]string{"u1": {"n1"}, "u2": {"n2"}}
+	if got := sortedLocate(t, r, "u1", "u2"); !reflect.DeepEqual(got, want) {
+		t.Errorf("after remove: got %v, want %v", got, want)
+	}
+	if members, _ := server.Members(nodeUsersKey("n2")); !reflect.DeepEqual(members, []string{"u2"}) {
+		t.Errorf("node n2 users after remove: %v", members)
+	}
+
+	if err := r.ResetNode("n1"); err != nil {
+		t.Fatal(err)
+	}
+	want = map[string][]string{"u2": {"n2"}}
+	if got := sortedLocate(t, r, "u1", "u2"); !reflect.DeepEqual(got, want) {
+		t.Errorf("after reset: got %v, want %v", got, want)
+	}
+	if server.Exists(nodeUsersKey("n1")) {
+		t.Error("node users set still exists after reset")
+	}
+
+	// 空列表不访问 Redis
+	before = server.CommandCount()
+	if got := sortedLocate(t, r); len(got) != 0 {
+		t.Errorf("empty Locate: got %v", got)
+	}
+	if got := server.CommandCount() - before; got != 0 {
+		t.Errorf("empty Locate sent %d commands", got)
+	}
+}
+
+func TestRedisRegistryReconnects(t *testing.T) {
+	server := miniredis.RunT(t)
+	r := NewRedisRegistry(server.Addr(), "")
+	if err := r.Add("u1", "n1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.KeepAlive("n1", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	server.Close()
+	if err := server.Restart(); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]string{"u1": {"n1"}}
+	if got := sortedLocate(t, r, "u1"); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestRedisTicketStore(t *testing.T) {
+	server := miniredis.RunT(t)
+	store := NewRedisTicketStore(server.Addr(), "")
+	testTicketStore(t, store, server.FastForward)
+
+	// SET NX：同名票据不会被覆盖
+	if err := store.Issue("t3", []byte(`{}`), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Issue("t3", []byte(`{"user_id":2}`), time.Minute); err == nil {
+		t.Error("expected error when issuing an existing ticket")
+	}
+}
+
+// testTicketStore 票据只能使用一次，过期后失效；advance 让存储的时钟前进
+func testTicketStore(t *testing.T, store TicketStore, advance func(time.Duration)) {
+	t.Helper()
+	if err := store.Issue("t1", []byte(`{"user_id":1}`), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	value, err := store.Consume("t1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(value) != `{"user_id":1}` {
+		t.Errorf("got %q", value)
+	}
+	if _, err := store.Consume("t1"); !errors.Is(err, ErrTicketNotFound) {
+		t.Errorf("second consume: got %v, want ErrTicketNotFound", err)
+	}
+	if _, err := store.Consume("missing"); !errors.Is(err, ErrTicketNotFound) {
+		t.Errorf("missing: got %v, want ErrTicketNotFound", err)
+	}
+
+	if err := store.Issue("t2", []byte(`{}`), 20*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	advance(50 * time.Millisecond)
+	if _, err := store.Consume("t2"); !errors.Is(err, ErrTicketNotFound) {
+		t.Errorf("expired: got %v, want ErrTicketNotFound", err)
+	}
+}
@@ -4,6 +4,9 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 	"gorm.io/driver/mysql"
@@ -28,3 +31,103 @@ func InitDB() {
 	}
 	log.Println("Database connected successfully")
 }
+
+// durationFromEnv 读取时长类型的环境变量（如 "15m"），未配置或格式错误时使用默认值
+func durationFromEnv(key string, fallback time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if d, err := time.ParseDuration(value); err == nil {
+			return d
+		}
+		log.Printf("Invalid duration for %s: %q, using %v", key, value, fallback)
+	}
+	return fallback
+}
+
+// MessageEditWindow 消息发出后允许编辑的时长
+func MessageEditWindow() time.Duration {
+	return durationFromEnv("MESSAGE_EDIT_WINDOW", 15*time.Minute)
+}
+
+// MessageRecallWindow 消息发出后允许撤回的时长
+func MessageRecallWindow() time.Duration {
+	return durationFromEnv("MESSAGE_RECALL_WINDOW", 2*time.Minute)
+}
+
+// PresenceGracePeriod 最后一个连接断开后多久才标记为离线，期间重连不产生状态变化
+func PresenceGracePeriod() time.Duration {
+	return durationFromEnv("PRESENCE_GRACE_PERIOD", 20*time.Second)
+}
+
+// SearchBackend 消息搜索后端：mysql（FULLTEXT，默认）或 memory（进程内索引）。
+// memory 索引启动时从数据库全量回填，消息多时启动变慢，且只适合单节点部署
+func SearchBackend() string {
+	if backend := os.Getenv("SEARCH_BACKEND"); backend != "" {
+		return backend
+	}
+	return "mysql"
+}
+
+// UploadDir 本地附件存储目录
+func UploadDir() string {
+	if dir := os.Getenv("UPLOAD_DIR"); dir != "" {
+		return dir
+	}
+	return "uploads"
+}
+
+// MaxUploadSize 单个附件的大小上限（字节）
+func MaxUploadSize() int64 {
+	if value := os.Getenv("MAX_UPLOAD_SIZE"); value != "" {
+		if size, err := strconv.ParseInt(value, 10, 64); err == nil && size > 0 {
+			return size
+		}
+		log.Printf("Invalid MAX_UPLOAD_SIZE: %q", value)
+	}
+	return 20 << 20
+}
+
+// BusBackend 节点间消息总线：memory（单节点）或 redis（多节点）
+func BusBackend() string {
+	if backend := os.Getenv("BUS_BACKEND"); backend != "" {
+		return backend
+	}
+	return "memory"
+}
+
+// RedisAddr Redis 地址，BUS_BACKEND=redis 时使用
+func RedisAddr() string {
+	if addr := os.Getenv("REDIS_ADDR"); addr != "" {
+		return addr
+	}
+	return "127.0.0.1:6379"
+}
+
+// RedisPassword Redis 密码，未设置时不发送 AUTH
+func RedisPassword() string {
+	return os.Getenv("REDIS_PASSWORD")
+}
+
+// NodeID 当前节点的 ID，默认为主机名。同一主机上运行多个实例时需为每个实例配置固定且唯一的值，
+// 重启后沿用同一 ID 才能清理上次运行残留的连接记录
+func NodeID() string {
+	if nodeID := os.Getenv("NODE_ID"); nodeID != "" {
+		return nodeID
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return "localhost"
+	}
+	return hostname
+}
+
+// TrustedProxies 受信任的反向代理地址或网段（逗号分隔），只有来自这些地址的请求才采信 X-Forwarded-For，
+// 默认不信任任何代理
+func TrustedProxies() []string {
+	var proxies []string
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	return proxies
+}
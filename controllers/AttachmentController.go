@@ -0,0 +1,124 @@
+package controllers
+
+import (
+	"chat-system/config"
+	"chat-system/services"
+	"chat-system/utils"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// multipartOverhead 请求体中 multipart 边界和字段的额外开销
+const multipartOverhead = 1 << 20
+
+// UploadAttachment 上传附件（multipart 字段 file），返回附件 ID 供发送消息时引用
+func UploadAttachment(c *gin.Context) {
+	userInfo, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	maxSize := config.MaxUploadSize()
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxSize+multipartOverhead)
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			utils.RespondFailed(c, services.ErrAttachmentTooLarge.Error())
+			return
+		}
+		utils.RespondFailed(c, "File is required")
+		return
+	}
+	if fileHeader.Size > maxSize {
+		utils.RespondFailed(c, services.ErrAttachmentTooLarge.Error())
+		return
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		utils.RespondFailed(c, "Failed to read file")
+		return
+	}
+	defer file.Close()
+
+	view, err := services.UploadAttachment(fmt.Sprint(userInfo.ID), fileHeader.Filename, file)
+	if err != nil {
+		log.Println("Error uploading attachment:", err)
+		utils.RespondFailed(c, err.Error())
+		return
+	}
+	utils.RespondSuccess(c, view, nil)
+}
+
+// GetAttachment 查询附件信息并签发新的下载链接
+func GetAttachment(c *gin.Context) {
+	userInfo, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	view, err := services.GetAttachmentForUser(c.Param("attachment_id"), fmt.Sprint(userInfo.ID))
+	if err != nil {
+		utils.RespondFailed(c, err.Error())
+		return
+	}
+	utils.RespondSuccess(c, view, nil)
+}
+
+// DownloadAttachment 通过签名链接下载附件，不需要 Authorization 头，便于 <img> 等直接引用
+func DownloadAttachment(c *gin.Context) {
+	attachmentID := c.Param("attachment_id")
+	if err := services.VerifyAttachmentURL(attachmentID+"/download", c.Query("expires"), c.Query("signature")); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
+	attachment, reader, err := services.OpenAttachment(attachmentID)
+	if err != nil {
+		log.Println("Error opening attachment:", err)
+		c.JSON(http.StatusNotFound, gin.H{"error": "Attachment not found"})
+		return
+	}
+	defer reader.Close()
+
+	// 图片、音视频可以内联展示，其余类型一律作为下载
+	disposition := "attachment"
+	if strings.HasPrefix(attachment.MimeType, "image/") || strings.HasPrefix(attachment.MimeType, "video/") ||
+		strings.HasPrefix(attachment.MimeType, "audio/") {
+		disposition = "inline"
+	}
+	c.DataFromReader(http.StatusOK, attachment.Size, attachment.MimeType, reader, map[string]string{
+		"Content-Disposition":    mime.FormatMediaType(disposition, map[string]string{"filename": attachment.FileName}),
+		"X-Content-Type-Options": "nosniff",
+		"Cache-Control":          "private, max-age=3600",
+	})
+}
+
+// DownloadThumbnail 通过签名链接获取图片缩略图
+func DownloadThumbnail(c *gin.Context) {
+	attachmentID, size := c.Param("attachment_id"), c.Param("size")
+	if err := services.VerifyAttachmentURL(attachmentID+"/thumbnails/"+size, c.Query("expires"), c.Query("signature")); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
+	thumbnail, reader, err := services.OpenThumbnail(attachmentID, size)
+	if err != nil {
+		log.Println("Error opening thumbnail:", err)
+		c.JSON(http.StatusNotFound, gin.H{"error": "Thumbnail not found"})
+		return
+	}
+	defer reader.Close()
+
+	c.DataFromReader(http.StatusOK, thumbnail.ByteSize, thumbnail.MimeType, reader, map[string]string{
+		"X-Content-Type-Options": "nosniff",
+		"Cache-Control":          "private, max-age=3600",
+	})
+}
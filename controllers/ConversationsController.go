@@ -3,8 +3,11 @@ package controllers
 import (
 	"chat-system/config"
 	"chat-system/models"
+	"chat-system/services"
 	"chat-system/utils"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 
@@ -31,7 +34,7 @@ func GetConversation(c *gin.Context) {
 	err := config.DB.
 		Preload("ParticipantAUser").
 		Preload("ParticipantBUser").
-		Where("(participant_a = ? OR participant_b = ?) OR (group_id IS NOT NULL AND ? IN (SELECT user_id FROM group_members WHERE group_members.group_id = conversations.group_id))",
+		Where("(participant_a = ? OR participant_b = ?) OR (group_id IS NOT NULL AND ? IN (SELECT user_id FROM group_members WHERE group_members.group_id = conversations.group_id AND group_members.deleted_at IS NULL))",
 			userInfo.ID, userInfo.ID, userInfo.ID).
 		Order("last_message_at DESC").
 		Find(&conversations).Error
@@ -41,6 +44,22 @@ func GetConversation(c *gin.Context) {
 		return
 	}
 
+	// 每个会话的未读数和未读 @ 数
+	conversationIDs := make([]string, 0, len(conversations))
+	for _, conv := range conversations {
+		conversationIDs = append(conversationIDs, conv.ConversationID)
+	}
+	unreadCounts, err := services.GetUnreadCounts(fmt.Sprint(userInfo.ID), conversationIDs)
+	if err != nil {
+		log.Println("Error counting unread messages:", err)
+		unreadCounts = map[string]int64{}
+	}
+	unreadMentionCounts, err := services.GetUnreadMentionCounts(fmt.Sprint(userInfo.ID), conversationIDs)
+	if err != nil {
+		log.Println("Error counting unread mentions:", err)
+		unreadMentionCounts = map[string]int64{}
+	}
+
 	// 处理返回的数据，仅返回对方用户信息
 	formattedConversations := make([]map[string]interface{}, 0)
 
@@ -58,21 +77,28 @@ func GetConversation(c *gin.Context) {
 				"conversation_id": conv.ConversationID,
 				"type":            "private",
 				"participant": map[string]interface{}{
-					"user_id":    otherUser.ID,
-					"username":   otherUser.Username,
-					"email":      otherUser.Email,
-					"avatar":     otherUser.AvatarURL,
-					"last_login": otherUser.LastLogin,
+					"user_id":       otherUser.ID,
+					"username":      otherUser.Username,
+					"email":         otherUser.Email,
+					"avatar":        otherUser.AvatarURL,
+					"last_login":    otherUser.LastLogin,
+					"status":        otherUser.Status,
+					"last_seen":     otherUser.LastSeen,
+					"custom_status": services.ActiveCustomStatus(otherUser),
+					"dnd":           services.IsInDND(fmt.Sprint(otherUser.ID)),
 				},
 				"last_message_at": conv.LastMessageAt, // 添加最后一条消息时间
+				"unread_count":    unreadCounts[conv.ConversationID],
 			})
 		} else {
 			// 处理群聊
 			formattedConversations = append(formattedConversations, map[string]interface{}{
-				"conversation_id": conv.ConversationID,
-				"type":            "group",
-				"group_id":        conv.GroupID,
-				"last_message_at": conv.LastMessageAt, // 添加最后一条消息时间
+				"conversation_id":      conv.ConversationID,
+				"type":                 "group",
+				"group_id":             conv.GroupID,
+				"last_message_at":      conv.LastMessageAt, // 添加最后一条消息时间
+				"unread_count":         unreadCounts[conv.ConversationID],
+				"unread_mention_count": unreadMentionCounts[conv.ConversationID],
 			})
 		}
 	}
@@ -191,3 +217,52 @@ func GetConversationByID(c *gin.Context) {
 
 	utils.RespondSuccess(c, responseData, nil)
 }
+
+// MarkConversationRead 推进当前用户在会话中的已读游标
+func MarkConversationRead(c *gin.Context) {
+	userInfo, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		MessageID uint `json:"message_id"` // 为空时表示读到最新一条
+	}
+	if err := c.ShouldBindJSON(&input); err != nil && !errors.Is(err, io.EOF) {
+		utils.RespondFailed(c, "Invalid request body")
+		return
+	}
+
+	participant, _, err := services.MarkConversationRead(c.Param("conversation_id"), fmt.Sprint(userInfo.ID), input.MessageID)
+	if err != nil {
+		utils.RespondFailed(c, err.Error())
+		return
+	}
+	utils.RespondSuccess(c, participant, nil)
+}
+
+// GetPinnedMessages 获取会话的置顶消息列表
+func GetPinnedMessages(c *gin.Context) {
+	userInfo, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	conversation, err := services.GetConversationByID(c.Param("conversation_id"))
+	if err != nil {
+		utils.RespondFailed(c, "Conversation not found")
+		return
+	}
+	if isMember, _ := services.IsConversationMember(conversation, fmt.Sprint(userInfo.ID)); !isMember {
+		utils.RespondFailed(c, "You are not part of this conversation")
+		return
+	}
+
+	pins, err := services.GetPinnedMessages(conversation.ConversationID)
+	if err != nil {
+		log.Println("Error fetching pinned messages:", err)
+		utils.RespondFailed(c, "Failed to fetch pinned messages")
+		return
+	}
+	utils.RespondSuccess(c, pins, nil)
+}
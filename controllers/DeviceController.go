@@ -0,0 +1,37 @@
+package controllers
+
+import (
+	"chat-system/services"
+	"chat-system/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetMyDevices 列出当前用户在线的设备
+func GetMyDevices(c *gin.Context) {
+	userInfo, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	devices, err := services.GetUserDevices(userInfo.ID)
+	if err != nil {
+		utils.RespondFailed(c, "Failed to fetch devices")
+		return
+	}
+	utils.RespondSuccess(c, devices, nil)
+}
+
+// SignOutDevice 断开指定设备的全部 WebSocket 连接
+func SignOutDevice(c *gin.Context) {
+	userInfo, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	if err := services.SignOutDevice(userInfo.ID, c.Param("device_id")); err != nil {
+		utils.RespondFailed(c, err.Error())
+		return
+	}
+	utils.RespondSuccess(c, gin.H{"device_id": c.Param("device_id")}, nil)
+}
@@ -0,0 +1,578 @@
+package controllers
+
+import (
+	"chat-system/config"
+	"chat-system/models"
+	"chat-system/services"
+	"chat-system/utils"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// CreateGroup 创建群组，同时创建对应的群聊会话
+func CreateGroup(c *gin.Context) {
+	userInfo, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		GroupName   string `json:"group_name" binding:"required"`
+		Description string `json:"description"`
+		MemberIDs   []uint `json:"member_ids"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.RespondFailed(c, "Invalid request body")
+		return
+	}
+
+	// 群主自动成为成员，其余成员需真实存在
+	memberIDs := uniqueUserIDs(append([]uint{userInfo.ID}, input.MemberIDs...))
+	var count int64
+	config.DB.Model(&models.User{}).Where("id IN ?", memberIDs).Count(&count)
+	if int(count) != len(memberIDs) {
+		utils.RespondFailed(c, "Some members do not exist")
+		return
+	}
+
+	group := models.Group{
+		GroupName:   input.GroupName,
+		OwnerID:     userInfo.ID,
+		Description: input.Description,
+	}
+	conversation := models.Conversation{
+		ConversationID: uuid.New().String(),
+		Type:           "group",
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&group).Error; err != nil {
+			return err
+		}
+		// GroupID 与自增 ID 保持一致，作为对外的群组 ID
+		if err := tx.Model(&group).Update("group_id", group.ID).Error; err != nil {
+			return err
+		}
+		group.GroupID = group.ID
+
+		conversation.GroupID = fmt.Sprint(group.GroupID)
+		if err := tx.Create(&conversation).Error; err != nil {
+			return err
+		}
+		if err := addGroupMembers(tx, &group, conversation.ConversationID, memberIDs[:1], models.GroupRoleOwner); err != nil {
+			return err
+		}
+		return addGroupMembers(tx, &group, conversation.ConversationID, memberIDs[1:], models.GroupRoleMember)
+	})
+	if err != nil {
+		log.Println("Error creating group:", err)
+		utils.RespondFailed(c, "Failed to create group")
+		return
+	}
+
+	utils.RespondSuccess(c, gin.H{
+		"group":           group,
+		"conversation_id": conversation.ConversationID,
+	}, nil)
+}
+
+// GetMyGroups 获取当前用户加入的群组列表
+func GetMyGroups(c *gin.Context) {
+	userInfo, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	var groups []models.Group
+	err := config.DB.
+		Where("group_id IN (?)", config.DB.Model(&models.GroupMember{}).Select("group_id").Where("user_id = ?", userInfo.ID)).
+		Order("created_at DESC").
+		Find(&groups).Error
+	if err != nil {
+		log.Println("Error fetching groups:", err)
+		utils.RespondFailed(c, "Failed to fetch groups")
+		return
+	}
+
+	// 群组对应的会话 ID
+	groupIDs := make([]string, 0, len(groups))
+	for _, group := range groups {
+		groupIDs = append(groupIDs, fmt.Sprint(group.GroupID))
+	}
+	var conversations []models.Conversation
+	config.DB.Where("group_id IN ?", groupIDs).Find(&conversations)
+	conversationIDs := make(map[string]string, len(conversations))
+	for _, conv := range conversations {
+		conversationIDs[conv.GroupID] = conv.ConversationID
+	}
+
+	result := make([]map[string]interface{}, 0, len(groups))
+	for _, group := range groups {
+		result = append(result, map[string]interface{}{
+			"group_id":        group.GroupID,
+			"group_name":      group.GroupName,
+			"description":     group.Description,
+			"owner_id":        group.OwnerID,
+			"conversation_id": conversationIDs[fmt.Sprint(group.GroupID)],
+		})
+	}
+	utils.RespondSuccess(c, result, nil)
+}
+
+// GetGroup 获取群组详情及成员列表
+func GetGroup(c *gin.Context) {
+	userInfo, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	group, ok := loadGroup(c)
+	if !ok {
+		return
+	}
+
+	var members []models.GroupMember
+	config.DB.Where("group_id = ?", group.GroupID).Find(&members)
+	isMember := false
+	userIDs := make([]uint, 0, len(members))
+	for _, member := range members {
+		if member.UserID == userInfo.ID {
+			isMember = true
+		}
+		userIDs = append(userIDs, member.UserID)
+	}
+	if !isMember {
+		utils.RespondFailed(c, services.ErrNotGroupMember.Error())
+		return
+	}
+
+	var users []models.User
+	config.DB.Where("id IN ?", userIDs).Find(&users)
+	usersByID := make(map[uint]models.User, len(users))
+	for _, user := range users {
+		usersByID[user.ID] = user
+	}
+	memberList := make([]map[string]interface{}, 0, len(members))
+	for _, member := range members {
+		user := usersByID[member.UserID]
+		memberList = append(memberList, map[string]interface{}{
+			"user_id":  member.UserID,
+			"username": user.Username,
+			"avatar":   user.AvatarURL,
+			"role":     member.Role,
+		})
+	}
+
+	var conversation models.Conversation
+	config.DB.Where("group_id = ?", fmt.Sprint(group.GroupID)).First(&conversation)
+
+	utils.RespondSuccess(c, gin.H{
+		"group":           group,
+		"conversation_id": conversation.ConversationID,
+		"members":         memberList,
+	}, nil)
+}
+
+// UpdateGroup 修改群名称和描述，需要 rename 权限
+func UpdateGroup(c *gin.Context) {
+	userInfo, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	group, ok := loadGroup(c)
+	if !ok {
+		return
+	}
+	if _, err := services.CheckGroupPermission(fmt.Sprint(group.GroupID), fmt.Sprint(userInfo.ID), services.PermRename); err != nil {
+		utils.RespondFailed(c, err.Error())
+		return
+	}
+
+	var input struct {
+		GroupName   *string `json:"group_name"`
+		Description *string `json:"description"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.RespondFailed(c, "Invalid request body")
+		return
+	}
+
+	updates := map[string]interface{}{}
+	if input.GroupName != nil {
+		if *input.GroupName == "" {
+			utils.RespondFailed(c, "Group name cannot be empty")
+			return
+		}
+		updates["group_name"] = *input.GroupName
+	}
+	if input.Description != nil {
+		updates["description"] = *input.Description
+	}
+	if len(updates) > 0 {
+		if err := config.DB.Model(group).Updates(updates).Error; err != nil {
+			log.Println("Error updating group:", err)
+			utils.RespondFailed(c, "Failed to update group")
+			return
+		}
+	}
+
+	utils.RespondSuccess(c, group, nil)
+}
+
+// AddGroupMembers 添加群成员，需要 invite 权限
+func AddGroupMembers(c *gin.Context) {
+	userInfo, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	group, ok := loadGroup(c)
+	if !ok {
+		return
+	}
+	if _, err := services.CheckGroupPermission(fmt.Sprint(group.GroupID), fmt.Sprint(userInfo.ID), services.PermInvite); err != nil {
+		utils.RespondFailed(c, err.Error())
+		return
+	}
+
+	var input struct {
+		UserIDs []uint `json:"user_ids" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.RespondFailed(c, "Invalid request body")
+		return
+	}
+
+	userIDs := uniqueUserIDs(input.UserIDs)
+	var count int64
+	config.DB.Model(&models.User{}).Where("id IN ?", userIDs).Count(&count)
+	if int(count) != len(userIDs) {
+		utils.RespondFailed(c, "Some users do not exist")
+		return
+	}
+
+	// 跳过已经在群里的用户
+	var existing []uint
+	config.DB.Model(&models.GroupMember{}).Where("group_id = ? AND user_id IN ?", group.GroupID, userIDs).Pluck("user_id", &existing)
+	existingSet := make(map[uint]bool, len(existing))
+	for _, id := range existing {
+		existingSet[id] = true
+	}
+	newIDs := make([]uint, 0, len(userIDs))
+	for _, id := range userIDs {
+		if !existingSet[id] {
+			newIDs = append(newIDs, id)
+		}
+	}
+
+	conversationID := groupConversationID(group)
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		return addGroupMembers(tx, group, conversationID, newIDs, models.GroupRoleMember)
+	})
+	if err != nil {
+		log.Println("Error adding group members:", err)
+		utils.RespondFailed(c, "Failed to add members")
+		return
+	}
+	services.Typing.InvalidateMembers(conversationID)
+
+	utils.RespondSuccess(c, gin.H{"added": newIDs}, nil)
+}
+
+// RemoveGroupMember 移除群成员，需要 kick 权限且只能移除角色低于自己的成员
+func RemoveGroupMember(c *gin.Context) {
+	userInfo, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	group, ok := loadGroup(c)
+	if !ok {
+		return
+	}
+	actor, err := services.CheckGroupPermission(fmt.Sprint(group.GroupID), fmt.Sprint(userInfo.ID), services.PermKick)
+	if err != nil {
+		utils.RespondFailed(c, err.Error())
+		return
+	}
+
+	targetID := c.Param("user_id")
+	target, err := services.GetGroupMember(fmt.Sprint(group.GroupID), targetID)
+	if err != nil {
+		utils.RespondFailed(c, "User is not a member of this group")
+		return
+	}
+	if !services.CanManageMember(actor.Role, target.Role) {
+		utils.RespondFailed(c, services.ErrPermissionDenied.Error())
+		return
+	}
+
+	if err := removeGroupMember(group, targetID); err != nil {
+		utils.RespondFailed(c, err.Error())
+		return
+	}
+	utils.RespondSuccess(c, nil, nil)
+}
+
+// LeaveGroup 退出群组，群主需先解散群组
+func LeaveGroup(c *gin.Context) {
+	userInfo, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	group, ok := loadGroup(c)
+	if !ok {
+		return
+	}
+	if group.OwnerID == userInfo.ID {
+		utils.RespondFailed(c, "The group owner cannot leave, transfer ownership or dissolve the group instead")
+		return
+	}
+
+	if err := removeGroupMember(group, fmt.Sprint(userInfo.ID)); err != nil {
+		utils.RespondFailed(c, err.Error())
+		return
+	}
+	utils.RespondSuccess(c, nil, nil)
+}
+
+// DissolveGroup 解散群组，删除成员和群聊会话，需要 dissolve 权限
+func DissolveGroup(c *gin.Context) {
+	userInfo, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	group, ok := loadGroup(c)
+	if !ok {
+		return
+	}
+	if _, err := services.CheckGroupPermission(fmt.Sprint(group.GroupID), fmt.Sprint(userInfo.ID), services.PermDissolve); err != nil {
+		utils.RespondFailed(c, err.Error())
+		return
+	}
+
+	conversationID := groupConversationID(group)
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("group_id = ?", group.GroupID).Delete(&models.GroupMember{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("conversation_id = ?", conversationID).Delete(&models.ConversationParticipant{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("conversation_id = ?", conversationID).Delete(&models.Conversation{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(group).Error
+	})
+	if err != nil {
+		log.Println("Error dissolving group:", err)
+		utils.RespondFailed(c, "Failed to dissolve group")
+		return
+	}
+	services.Typing.InvalidateMembers(conversationID)
+
+	utils.RespondSuccess(c, nil, nil)
+}
+
+// SetGroupMemberRole 设置或取消管理员，需要 set_role 权限
+func SetGroupMemberRole(c *gin.Context) {
+	userInfo, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	group, ok := loadGroup(c)
+	if !ok {
+		return
+	}
+	if _, err := services.CheckGroupPermission(fmt.Sprint(group.GroupID), fmt.Sprint(userInfo.ID), services.PermSetRole); err != nil {
+		utils.RespondFailed(c, err.Error())
+		return
+	}
+
+	var input struct {
+		Role string `json:"role" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.RespondFailed(c, "Invalid request body")
+		return
+	}
+	// 群主只能通过转让产生
+	if input.Role != models.GroupRoleAdmin && input.Role != models.GroupRoleMember {
+		utils.RespondFailed(c, "Role must be admin or member")
+		return
+	}
+
+	target, err := services.GetGroupMember(fmt.Sprint(group.GroupID), c.Param("user_id"))
+	if err != nil {
+		utils.RespondFailed(c, "User is not a member of this group")
+		return
+	}
+	if target.Role == models.GroupRoleOwner {
+		utils.RespondFailed(c, "Cannot change the role of the group owner")
+		return
+	}
+
+	if err := config.DB.Model(target).Update("role", input.Role).Error; err != nil {
+		log.Println("Error updating member role:", err)
+		utils.RespondFailed(c, "Failed to update role")
+		return
+	}
+	utils.RespondSuccess(c, target, nil)
+}
+
+// TransferGroupOwnership 转让群主，原群主降为管理员
+func TransferGroupOwnership(c *gin.Context) {
+	userInfo, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	group, ok := loadGroup(c)
+	if !ok {
+		return
+	}
+	owner, err := services.CheckGroupPermission(fmt.Sprint(group.GroupID), fmt.Sprint(userInfo.ID), services.PermTransfer)
+	if err != nil {
+		utils.RespondFailed(c, err.Error())
+		return
+	}
+
+	var input struct {
+		UserID uint `json:"user_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.RespondFailed(c, "Invalid request body")
+		return
+	}
+	if input.UserID == userInfo.ID {
+		utils.RespondFailed(c, "You are already the group owner")
+		return
+	}
+	target, err := services.GetGroupMember(fmt.Sprint(group.GroupID), fmt.Sprint(input.UserID))
+	if err != nil {
+		utils.RespondFailed(c, "User is not a member of this group")
+		return
+	}
+
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(owner).Update("role", models.GroupRoleAdmin).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(target).Update("role", models.GroupRoleOwner).Error; err != nil {
+			return err
+		}
+		return tx.Model(group).Update("owner_id", target.UserID).Error
+	})
+	if err != nil {
+		log.Println("Error transferring group ownership:", err)
+		utils.RespondFailed(c, "Failed to transfer ownership")
+		return
+	}
+	utils.RespondSuccess(c, group, nil)
+}
+
+// UpdateGroupAnnouncement 发布群公告，需要 announce 权限
+func UpdateGroupAnnouncement(c *gin.Context) {
+	userInfo, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	group, ok := loadGroup(c)
+	if !ok {
+		return
+	}
+	if _, err := services.CheckGroupPermission(fmt.Sprint(group.GroupID), fmt.Sprint(userInfo.ID), services.PermAnnounce); err != nil {
+		utils.RespondFailed(c, err.Error())
+		return
+	}
+
+	var input struct {
+		Announcement string `json:"announcement"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.RespondFailed(c, "Invalid request body")
+		return
+	}
+
+	now := time.Now()
+	if err := config.DB.Model(group).Updates(map[string]interface{}{
+		"announcement":            input.Announcement,
+		"announcement_updated_at": now,
+	}).Error; err != nil {
+		log.Println("Error updating group announcement:", err)
+		utils.RespondFailed(c, "Failed to update announcement")
+		return
+	}
+	utils.RespondSuccess(c, group, nil)
+}
+
+// loadGroup 根据 URL 中的 group_id 查询群组
+func loadGroup(c *gin.Context) (*models.Group, bool) {
+	var group models.Group
+	if err := config.DB.Where("group_id = ?", c.Param("group_id")).First(&group).Error; err != nil {
+		utils.RespondFailed(c, "Group not found")
+		return nil, false
+	}
+	return &group, true
+}
+
+// groupConversationID 查询群组对应的会话 ID
+func groupConversationID(group *models.Group) string {
+	var conversation models.Conversation
+	config.DB.Where("group_id = ?", fmt.Sprint(group.GroupID)).First(&conversation)
+	return conversation.ConversationID
+}
+
+// addGroupMembers 以指定角色写入群成员以及对应的会话参与者记录
+func addGroupMembers(tx *gorm.DB, group *models.Group, conversationID string, userIDs []uint, role string) error {
+	for _, userID := range userIDs {
+		if err := tx.Create(&models.GroupMember{GroupID: group.GroupID, UserID: userID, Role: role}).Error; err != nil {
+			return err
+		}
+		participant := models.ConversationParticipant{
+			ConversationID: conversationID,
+			UserID:         fmt.Sprint(userID),
+		}
+		if err := tx.Where(participant).FirstOrCreate(&participant).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeGroupMember 删除群成员以及对应的会话参与者记录
+func removeGroupMember(group *models.Group, userID string) error {
+	conversationID := groupConversationID(group)
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("group_id = ? AND user_id = ?", group.GroupID, userID).Delete(&models.GroupMember{})
+		if result.Error != nil {
+			log.Println("Error removing group member:", result.Error)
+			return fmt.Errorf("failed to remove member")
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("user is not a member of this group")
+		}
+		return tx.Where("conversation_id = ? AND user_id = ?", conversationID, userID).
+			Delete(&models.ConversationParticipant{}).Error
+	})
+	if err != nil {
+		return err
+	}
+	services.Typing.InvalidateMembers(conversationID)
+	return nil
+}
+
+// uniqueUserIDs 去重并保持原有顺序
+func uniqueUserIDs(ids []uint) []uint {
+	seen := make(map[uint]bool, len(ids))
+	result := make([]uint, 0, len(ids))
+	for _, id := range ids {
+		if id == 0 || seen[id] {
+			continue
+		}
+		seen[id] = true
+		result = append(result, id)
+	}
+	return result
+}
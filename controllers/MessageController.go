@@ -3,22 +3,31 @@ package controllers
 import (
 	"chat-system/config"
 	"chat-system/models"
+	"chat-system/services"
 	"chat-system/utils"
 	"fmt"
 	"log"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
 // 发送消息
 func SendMessage(c *gin.Context) {
+	userInfo, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
 	var input struct {
-		ConversationID string `json:"conversation_id" binding:"required"`
-		SenderID       string `json:"sender_id" binding:"required"`
-		ReceiverID     string `json:"receiver_id" binding:"required"`
-		Content        string `json:"content" binding:"required"`
-		MessageType    string `json:"message_type" binding:"required"`
+		ConversationID string   `json:"conversation_id" binding:"required"`
+		Content        string   `json:"content"` // 带附件时可以为空
+		MessageType    string   `json:"message_type" binding:"required"`
+		ClientMsgID    string   `json:"client_msg_id" binding:"max=64"` // 可选，客户端生成的幂等 ID
+		ReplyTo        uint     `json:"reply_to"`                       // 可选，引用回复的消息 ID
+		AttachmentIDs  []string `json:"attachment_ids"`                 // 可选，已上传的附件 ID
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -26,31 +35,28 @@ func SendMessage(c *gin.Context) {
 		return
 	}
 
-	message := models.Message{
+	message, duplicate, err := services.SendChatMessage(fmt.Sprint(userInfo.ID), services.SendMessageInput{
 		ConversationID: input.ConversationID,
-		SenderID:       input.SenderID,
-		ReceiverID:     input.ReceiverID,
 		Content:        input.Content,
 		MessageType:    input.MessageType,
-		Status:         "sent", // 初始状态为已发送
-	}
-
-	if err := config.DB.Create(&message).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send message"})
-		return
-	}
-
-	// 更新会话中的最后一条消息ID
-	if err := config.DB.Model(&models.Conversation{}).Where("conversation_id = ?", input.ConversationID).
-		Update("last_message_id", message.ID).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update conversation"})
+		ClientMsgID:    input.ClientMsgID,
+		ReplyToID:      input.ReplyTo,
+		AttachmentIDs:  input.AttachmentIDs,
+	})
+	if err != nil {
+		log.Println("Error sending message:", err)
+		utils.RespondFailed(c, err.Error())
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"message":    "Message sent successfully",
-		"message_id": message.MessageID,
-	})
+	utils.RespondSuccess(c, gin.H{
+		"message_id":      message.ID,
+		"client_msg_id":   message.ClientMsgID,
+		"conversation_id": message.ConversationID,
+		"status":          message.Status,
+		"created_at":      message.CreatedAt,
+		"duplicate":       duplicate,
+	}, nil)
 }
 
 // 获取会话的消息列表
@@ -79,18 +85,15 @@ func GetMessagesByConversationID(c *gin.Context) {
 		return
 	}
 
-	// 确保用户是该会话的成员
-	if conversation.ParticipantA != fmt.Sprint(userInfo.ID) && conversation.ParticipantB != fmt.Sprint(userInfo.ID) && conversation.GroupID == "" {
+	// 确保用户是该会话的成员（群聊需校验群成员）
+	isMember, err := services.IsConversationMember(&conversation, fmt.Sprint(userInfo.ID))
+	if err != nil || !isMember {
 		c.JSON(http.StatusForbidden, gin.H{"error": "You are not part of this conversation"})
 		return
 	}
 
-	// 获取会话的所有消息
-	var messages []models.Message
-	err = config.DB.
-		Where("conversation_id = ?", conversationID).
-		Order("created_at ASC"). // 按时间排序（最早的在前）
-		Find(&messages).Error
+	// 按游标分页获取消息：?before=<id>&limit=50 向前翻页，?after=<id> 获取更新的消息
+	page, err := services.GetConversationMessages(conversationID, fmt.Sprint(userInfo.ID), utils.GetCursorPagination(c))
 	if err != nil {
 		log.Println("Error fetching messages:", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch messages"})
@@ -98,5 +101,338 @@ func GetMessagesByConversationID(c *gin.Context) {
 	}
 
 	// 返回消息列表
+	utils.RespondSuccess(c, page, nil)
+}
+
+// GetMessageReadBy 获取某条消息的已读成员列表（主要用于群聊）
+func GetMessageReadBy(c *gin.Context) {
+	userInfo, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	message, conversation, ok := loadMessageForMember(c, userInfo)
+	if !ok {
+		return
+	}
+
+	readers, err := services.GetMessageReadBy(message)
+	if err != nil {
+		log.Println("Error fetching message readers:", err)
+		utils.RespondFailed(c, "Failed to fetch readers")
+		return
+	}
+	memberIDs, _ := services.GetConversationMemberIDs(conversation)
+
+	utils.RespondSuccess(c, gin.H{
+		"message_id":   message.ID,
+		"read_by":      readers,
+		"read_count":   len(readers),
+		"member_count": len(memberIDs),
+	}, nil)
+}
+
+// EditMessage 编辑消息，仅发送者在允许的时间窗口内可编辑
+func EditMessage(c *gin.Context) {
+	userInfo, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Content string `json:"content" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.RespondFailed(c, "Invalid request body")
+		return
+	}
+	messageID, err := strconv.ParseUint(c.Param("message_id"), 10, 64)
+	if err != nil {
+		utils.RespondFailed(c, "Invalid message ID")
+		return
+	}
+
+	message, err := services.EditMessage(fmt.Sprint(userInfo.ID), uint(messageID), input.Content)
+	if err != nil {
+		utils.RespondFailed(c, err.Error())
+		return
+	}
+	utils.RespondSuccess(c, message, nil)
+}
+
+// RecallMessage 撤回消息（对所有人删除）
+func RecallMessage(c *gin.Context) {
+	userInfo, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	messageID, err := strconv.ParseUint(c.Param("message_id"), 10, 64)
+	if err != nil {
+		utils.RespondFailed(c, "Invalid message ID")
+		return
+	}
+
+	message, err := services.RecallMessage(fmt.Sprint(userInfo.ID), uint(messageID))
+	if err != nil {
+		utils.RespondFailed(c, err.Error())
+		return
+	}
+	utils.RespondSuccess(c, message, nil)
+}
+
+// DeleteMessageForMe 仅对自己删除消息
+func DeleteMessageForMe(c *gin.Context) {
+	userInfo, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	messageID, err := strconv.ParseUint(c.Param("message_id"), 10, 64)
+	if err != nil {
+		utils.RespondFailed(c, "Invalid message ID")
+		return
+	}
+
+	if err := services.DeleteMessageForMe(fmt.Sprint(userInfo.ID), uint(messageID)); err != nil {
+		utils.RespondFailed(c, err.Error())
+		return
+	}
+	utils.RespondSuccess(c, nil, nil)
+}
+
+// AddReaction 给消息添加表情回应
+func AddReaction(c *gin.Context) {
+	userInfo, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	var input struct {
+		Emoji string `json:"emoji" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.RespondFailed(c, "Invalid request body")
+		return
+	}
+	messageID, err := strconv.ParseUint(c.Param("message_id"), 10, 64)
+	if err != nil {
+		utils.RespondFailed(c, "Invalid message ID")
+		return
+	}
+
+	if err := services.AddReaction(fmt.Sprint(userInfo.ID), uint(messageID), input.Emoji); err != nil {
+		utils.RespondFailed(c, err.Error())
+		return
+	}
+	utils.RespondSuccess(c, nil, nil)
+}
+
+// RemoveReaction 取消自己的表情回应
+func RemoveReaction(c *gin.Context) {
+	userInfo, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	messageID, err := strconv.ParseUint(c.Param("message_id"), 10, 64)
+	if err != nil {
+		utils.RespondFailed(c, "Invalid message ID")
+		return
+	}
+
+	if err := services.RemoveReaction(fmt.Sprint(userInfo.ID), uint(messageID), c.Param("emoji")); err != nil {
+		utils.RespondFailed(c, err.Error())
+		return
+	}
+	utils.RespondSuccess(c, nil, nil)
+}
+
+// ForwardMessages 把一条或多条消息转发到目标会话
+func ForwardMessages(c *gin.Context) {
+	userInfo, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		MessageIDs           []uint `json:"message_ids" binding:"required"`
+		TargetConversationID string `json:"target_conversation_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.RespondFailed(c, "Invalid request body")
+		return
+	}
+
+	messages, err := services.ForwardMessages(fmt.Sprint(userInfo.ID), input.MessageIDs, input.TargetConversationID)
+	if err != nil {
+		utils.RespondFailed(c, err.Error())
+		return
+	}
 	utils.RespondSuccess(c, messages, nil)
 }
+
+// GetThread 获取消息所在话题的根消息及分页回复
+func GetThread(c *gin.Context) {
+	userInfo, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	message, _, ok := loadMessageForMember(c, userInfo)
+	if !ok {
+		return
+	}
+
+	thread, err := services.GetThread(message.ID, fmt.Sprint(userInfo.ID), utils.GetCursorPagination(c))
+	if err != nil {
+		log.Println("Error fetching thread:", err)
+		utils.RespondFailed(c, "Failed to fetch thread")
+		return
+	}
+	utils.RespondSuccess(c, thread, nil)
+}
+
+// PinMessage 置顶消息
+func PinMessage(c *gin.Context) {
+	userInfo, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	messageID, err := strconv.ParseUint(c.Param("message_id"), 10, 64)
+	if err != nil {
+		utils.RespondFailed(c, "Invalid message ID")
+		return
+	}
+
+	pin, err := services.PinMessage(fmt.Sprint(userInfo.ID), uint(messageID))
+	if err != nil {
+		utils.RespondFailed(c, err.Error())
+		return
+	}
+	utils.RespondSuccess(c, pin, nil)
+}
+
+// UnpinMessage 取消置顶
+func UnpinMessage(c *gin.Context) {
+	userInfo, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	messageID, err := strconv.ParseUint(c.Param("message_id"), 10, 64)
+	if err != nil {
+		utils.RespondFailed(c, "Invalid message ID")
+		return
+	}
+
+	if err := services.UnpinMessage(fmt.Sprint(userInfo.ID), uint(messageID)); err != nil {
+		utils.RespondFailed(c, err.Error())
+		return
+	}
+	utils.RespondSuccess(c, nil, nil)
+}
+
+// GetMyMentions 获取 @ 我的消息列表，?before=<mention_id>&limit=50 向前翻页
+func GetMyMentions(c *gin.Context) {
+	userInfo, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	page, err := services.GetMentionsOfUser(fmt.Sprint(userInfo.ID), utils.GetCursorPagination(c))
+	if err != nil {
+		log.Println("Error fetching mentions:", err)
+		utils.RespondFailed(c, "Failed to fetch mentions")
+		return
+	}
+	utils.RespondSuccess(c, page, nil)
+}
+
+// SearchMessages 在我参与的会话中全文搜索消息
+// 参数：q、conversation_id、sender_id、message_type、from / to（RFC3339 或 2006-01-02）、page、page_size
+func SearchMessages(c *gin.Context) {
+	userInfo, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	params := services.SearchParams{
+		Text:           c.Query("q"),
+		ConversationID: c.Query("conversation_id"),
+		SenderID:       c.Query("sender_id"),
+		MessageType:    c.Query("message_type"),
+	}
+	var err error
+	if params.From, err = parseSearchTime(c.Query("from"), false); err != nil {
+		utils.RespondFailed(c, "Invalid from date")
+		return
+	}
+	if params.To, err = parseSearchTime(c.Query("to"), true); err != nil {
+		utils.RespondFailed(c, "Invalid to date")
+		return
+	}
+
+	pagination := utils.GetPagination(c)
+	offset, limit := pagination.Paginate()
+	hits, total, err := services.SearchMessages(fmt.Sprint(userInfo.ID), params, offset, limit)
+	if err != nil {
+		utils.RespondFailed(c, err.Error())
+		return
+	}
+	pagination.Total = total
+	utils.RespondSuccess(c, gin.H{"results": hits}, &pagination)
+}
+
+// parseSearchTime 解析搜索时间参数，只给日期时 to 取当天结束
+func parseSearchTime(value string, endOfDay bool) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return &t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return nil, err
+	}
+	if endOfDay {
+		t = t.Add(24*time.Hour - time.Nanosecond)
+	}
+	return &t, nil
+}
+
+// GetMessageEdits 获取消息的编辑历史
+func GetMessageEdits(c *gin.Context) {
+	userInfo, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	message, _, ok := loadMessageForMember(c, userInfo)
+	if !ok {
+		return
+	}
+
+	edits, err := services.GetMessageEdits(message.ID)
+	if err != nil {
+		log.Println("Error fetching edit history:", err)
+		utils.RespondFailed(c, "Failed to fetch edit history")
+		return
+	}
+	utils.RespondSuccess(c, edits, nil)
+}
+
+// loadMessageForMember 根据 URL 中的 message_id 查询消息，并校验当前用户是该会话成员
+func loadMessageForMember(c *gin.Context, userInfo *models.User) (*models.Message, *models.Conversation, bool) {
+	var message models.Message
+	if err := config.DB.Where("id = ?", c.Param("message_id")).First(&message).Error; err != nil {
+		utils.RespondFailed(c, "Message not found")
+		return nil, nil, false
+	}
+
+	conversation, err := services.GetConversationByID(message.ConversationID)
+	if err != nil {
+		utils.RespondFailed(c, "Conversation not found")
+		return nil, nil, false
+	}
+	isMember, err := services.IsConversationMember(conversation, fmt.Sprint(userInfo.ID))
+	if err != nil || !isMember {
+		utils.RespondFailed(c, "You are not part of this conversation")
+		return nil, nil, false
+	}
+	return &message, conversation, true
+}
@@ -0,0 +1,24 @@
+package controllers
+
+import (
+	"chat-system/models"
+	"chat-system/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// currentUser 从上下文中取出 TokenAuthMiddleware 写入的用户信息，失败时直接响应错误
+func currentUser(c *gin.Context) (*models.User, bool) {
+	user, exists := c.Get("user")
+	if !exists {
+		utils.RespondFailed(c, "User not found")
+		return nil, false
+	}
+
+	userInfo, ok := user.(*models.User)
+	if !ok {
+		utils.RespondFailed(c, "Invalid user data")
+		return nil, false
+	}
+	return userInfo, true
+}
@@ -5,7 +5,9 @@ import (
 	"chat-system/models"
 	"chat-system/services"
 	"chat-system/utils"
+	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -123,3 +125,90 @@ func GetUserInfo(c *gin.Context) {
 	}
 	utils.RespondSuccess(c, data, nil)
 }
+
+// GetPresence 查询联系人的在线状态（?user_ids=1,2,3），非联系人不返回
+func GetPresence(c *gin.Context) {
+	userInfo, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	userIDs := make([]string, 0)
+	for _, id := range strings.Split(c.Query("user_ids"), ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			userIDs = append(userIDs, id)
+		}
+	}
+
+	snapshots, err := services.Presence.ContactSnapshot(fmt.Sprint(userInfo.ID), userIDs)
+	if err != nil {
+		utils.RespondFailed(c, "Failed to fetch presence")
+		return
+	}
+	utils.RespondSuccess(c, snapshots, nil)
+}
+
+// UpdateUserStatus 设置自定义状态文字和表情，可选过期时间；都为空时清除
+func UpdateUserStatus(c *gin.Context) {
+	userInfo, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Text      string     `json:"text"`
+		Emoji     string     `json:"emoji"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	status, err := services.SetCustomStatus(userInfo.ID, input.Text, input.Emoji, input.ExpiresAt)
+	if err != nil {
+		utils.RespondFailed(c, err.Error())
+		return
+	}
+	utils.RespondSuccess(c, gin.H{"custom_status": status}, nil)
+}
+
+// GetDNDSettings 查询免打扰设置
+func GetDNDSettings(c *gin.Context) {
+	userInfo, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	settings, err := services.GetDNDSettings(userInfo.ID)
+	if err != nil {
+		utils.RespondFailed(c, err.Error())
+		return
+	}
+	utils.RespondSuccess(c, settings, nil)
+}
+
+// UpdateDNDSettings 开关免打扰并整体替换定时时段
+func UpdateDNDSettings(c *gin.Context) {
+	userInfo, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Enabled   bool                        `json:"enabled"`
+		Until     *time.Time                  `json:"until"` // 可选，手动开启的截止时间
+		Schedules []services.DNDScheduleInput `json:"schedules"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	settings, err := services.SetDND(userInfo.ID, input.Enabled, input.Until, input.Schedules)
+	if err != nil {
+		utils.RespondFailed(c, err.Error())
+		return
+	}
+	utils.RespondSuccess(c, settings, nil)
+}
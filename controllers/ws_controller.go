@@ -1,7 +1,9 @@
 package controllers
 
 import (
+	"chat-system/models"
 	"chat-system/services"
+	"chat-system/utils"
 
 	"github.com/gin-gonic/gin"
 )
@@ -9,3 +11,24 @@ import (
 func WSController(ctx *gin.Context) {
 	services.HandleWebSocket(ctx)
 }
+
+// IssueWSTicket 签发 WebSocket 握手用的一次性票据（/ws?ticket=xxx）
+func IssueWSTicket(c *gin.Context) {
+	user, exists := c.Get("user")
+	if !exists {
+		utils.RespondFailed(c, "User not found")
+		return
+	}
+	userInfo, ok := user.(*models.User)
+	if !ok {
+		utils.RespondFailed(c, "Invalid user data")
+		return
+	}
+
+	ticket, expiresAt, err := services.IssueWSTicket(userInfo, c.GetString("token_id"))
+	if err != nil {
+		utils.RespondFailed(c, "Failed to issue ticket")
+		return
+	}
+	utils.RespondSuccess(c, gin.H{"ticket": ticket, "expires_at": expiresAt}, nil)
+}
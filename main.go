@@ -14,6 +14,19 @@ func main() {
 	config.InitDB()
 	// 自动迁移
 	models.Migrate()
+	// 接入节点间消息总线
+	if err := services.InitBus(); err != nil {
+		log.Fatalf("Message bus init failed: %v", err)
+	}
+	// 清理本节点上次运行残留的连接记录和在线状态
+	services.ResetConnections()
+	services.ResetPresence()
+	// 初始化消息搜索索引
+	services.InitSearchIndex()
+	// 初始化附件存储
+	if err := services.InitStorage(); err != nil {
+		log.Fatalf("Storage init failed: %v", err)
+	}
 
 	// 注册路由
 	r := routes.RegisterRoutes()
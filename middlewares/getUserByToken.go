@@ -29,7 +29,7 @@ func TokenAuthMiddleware() gin.HandlerFunc {
 		}
 
 		// 验证 Token 并获取用户信息
-		user, err := services.GetCurrentUser(tokenString)
+		user, tokenID, err := services.AuthenticateToken(tokenString)
 		if err != nil {
 			utils.RespondSuccess(c, gin.H{"message": "Invalid or expired token", "code": 401}, nil)
 			c.Abort()
@@ -38,6 +38,7 @@ func TokenAuthMiddleware() gin.HandlerFunc {
 
 		// 将用户信息存入上下文
 		c.Set("user", user)
+		c.Set("token_id", tokenID)
 
 		// 继续执行请求
 		c.Next()
@@ -15,10 +15,24 @@ func Migrate() {
 		&Conversation{},            // 会话表
 		&Group{},                   // 群组表
 		&WSConnection{},            // WebSocket 连接表
-		&GroupMember{},             // WebSocket 连接表
-		&ConversationParticipant{}, // WebSocket 连接表
+		&GroupMember{},             // 群组成员表
+		&ConversationParticipant{}, // 会话参与者表
+		&MessageEdit{},             // 消息编辑历史表
+		&MessageDeletion{},         // 仅对自己删除的消息
+		&MessageReaction{},         // 消息表情回应表
+		&PinnedMessage{},           // 置顶消息表
+		&MessageMention{},          // @ 提及记录表
+		&Attachment{},              // 附件表
+		&MessageAttachment{},       // 消息引用的附件
+		&AttachmentThumbnail{},     // 图片缩略图
+		&DNDSchedule{},             // 定时免打扰
+		&RevokedToken{},            // 被登出设备的 token
 	)
 	config.DB.Exec("ALTER TABLE users AUTO_INCREMENT = 10000;")
+	// 角色字段上线前创建的群，群主记录补齐 owner 角色
+	config.DB.Exec("UPDATE group_members JOIN `groups` ON `groups`.group_id = group_members.group_id SET group_members.role = 'owner' WHERE group_members.user_id = `groups`.owner_id AND group_members.role <> 'owner';")
+	// attached_at 上线前已被消息引用的附件补齐占用时间
+	config.DB.Exec("UPDATE attachments SET attached_at = created_at WHERE attached_at IS NULL AND EXISTS (SELECT 1 FROM message_attachments WHERE message_attachments.attachment_id = attachments.id);")
 	if err != nil {
 		log.Fatalf("Error migrating database: %v", err) // 错误处理
 	} else {
@@ -0,0 +1,39 @@
+package models
+
+import "time"
+
+// Attachment 上传的附件，文件内容保存在 storage 中
+type Attachment struct {
+	ID           uint      `gorm:"primaryKey;autoIncrement" json:"-"`
+	AttachmentID string    `gorm:"type:varchar(36);uniqueIndex" json:"attachment_id"` // 对外的附件 ID
+	UploaderID   string    `gorm:"type:varchar(36);index" json:"uploader_id"`
+	FileName     string    `json:"file_name"`                          // 原始文件名
+	MimeType     string    `gorm:"type:varchar(100)" json:"mime_type"` // 根据内容嗅探出的类型
+	Size         int64     `json:"size"`                               // 字节数
+	Checksum     string    `gorm:"type:varchar(64)" json:"checksum"`   // SHA-256
+	Width        int       `json:"width,omitempty"`                    // 图片宽度（已按 EXIF 方向校正）
+	Height       int       `json:"height,omitempty"`                   // 图片高度
+	StorageKey   string    `json:"-"`                                  // 存储中的 key
+	CreatedAt    time.Time `gorm:"autoCreateTime" json:"created_at"`
+
+	AttachedAt *time.Time `gorm:"index" json:"-"` // 首次被消息引用的时间，之后不能再用于新消息（转发除外）
+}
+
+// MessageAttachment 消息引用的附件，转发时新消息引用同一份附件
+type MessageAttachment struct {
+	MessageID    uint `gorm:"primaryKey" json:"message_id"`
+	AttachmentID uint `gorm:"primaryKey" json:"attachment_id"`
+	Position     int  `json:"position"` // 在消息中的顺序
+}
+
+// AttachmentThumbnail 图片附件的缩略图
+type AttachmentThumbnail struct {
+	ID           uint   `gorm:"primaryKey;autoIncrement" json:"-"`
+	AttachmentID uint   `gorm:"uniqueIndex:idx_attachment_thumbnail" json:"-"`
+	Size         string `gorm:"type:varchar(20);uniqueIndex:idx_attachment_thumbnail" json:"size"` // small / medium
+	MimeType     string `gorm:"type:varchar(100)" json:"mime_type"`
+	Width        int    `json:"width"`
+	Height       int    `json:"height"`
+	ByteSize     int64  `json:"byte_size"`
+	StorageKey   string `json:"-"`
+}
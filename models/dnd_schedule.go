@@ -0,0 +1,11 @@
+package models
+
+// DNDSchedule 定时免打扰时段，EndMinute 小于 StartMinute 表示跨越午夜
+type DNDSchedule struct {
+	ID          uint   `gorm:"primaryKey;autoIncrement" json:"-"`
+	UserID      uint   `gorm:"index" json:"user_id"`
+	Weekdays    int    `json:"weekdays"`                         // 位掩码，bit0 为周日，以开始时间所在的那天为准
+	StartMinute int    `json:"start_minute"`                     // 当天 0 点起的分钟数
+	EndMinute   int    `json:"end_minute"`                       // 同上，与开始相同表示全天
+	Timezone    string `gorm:"type:varchar(64)" json:"timezone"` // IANA 时区名，如 Asia/Shanghai
+}
@@ -1,14 +1,18 @@
 package models
 
 import (
+	"time"
+
 	"gorm.io/gorm"
 )
 
 // Group 群组模型
 type Group struct {
 	gorm.Model
-	GroupID     uint   `json:"group_id" gorm:"primaryKey"` // 群组ID
-	GroupName   string `json:"group_name"`                 // 群组名称
-	OwnerID     uint   `json:"owner_id"`                   // 群主ID
-	Description string `json:"description"`                // 群组描述
+	GroupID               uint       `json:"group_id" gorm:"primaryKey"` // 群组ID
+	GroupName             string     `json:"group_name"`                 // 群组名称
+	OwnerID               uint       `json:"owner_id"`                   // 群主ID
+	Description           string     `json:"description"`                // 群组描述
+	Announcement          string     `json:"announcement"`               // 群公告
+	AnnouncementUpdatedAt *time.Time `json:"announcement_updated_at"`    // 群公告更新时间
 }
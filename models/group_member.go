@@ -4,9 +4,17 @@ import (
 	"gorm.io/gorm"
 )
 
+// 群成员角色
+const (
+	GroupRoleOwner  = "owner"  // 群主
+	GroupRoleAdmin  = "admin"  // 管理员
+	GroupRoleMember = "member" // 普通成员
+)
+
 // GroupMember 群组成员模型
 type GroupMember struct {
 	gorm.Model
-	GroupID uint `json:"group_id"`
-	UserID  uint `json:"user_id"`
+	GroupID uint   `json:"group_id"`
+	UserID  uint   `json:"user_id"`
+	Role    string `json:"role" gorm:"type:varchar(10);default:'member'"` // 成员角色：owner / admin / member
 }
@@ -6,17 +6,66 @@ import (
 	"gorm.io/gorm"
 )
 
+// 消息状态：pending → sent → delivered → read，落库失败为 failed
+const (
+	MessageStatusPending   = "pending"   // 已接收，尚未完成存储
+	MessageStatusSent      = "sent"      // 已存储并投递给在线连接
+	MessageStatusDelivered = "delivered" // 接收方客户端已确认收到
+	MessageStatusRead      = "read"      // 接收方已读
+	MessageStatusFailed    = "failed"    // 存储失败
+)
+
+// messageStatusTransitions 允许的状态流转，read 和 failed 为终态
+var messageStatusTransitions = map[string][]string{
+	MessageStatusPending:   {MessageStatusSent, MessageStatusFailed},
+	MessageStatusSent:      {MessageStatusDelivered, MessageStatusRead},
+	MessageStatusDelivered: {MessageStatusRead},
+}
+
+// CanTransitionMessageStatus 判断消息能否从 from 流转到 to
+func CanTransitionMessageStatus(from, to string) bool {
+	for _, next := range messageStatusTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// MessageStatusPredecessors 返回可以流转到 to 的所有状态
+func MessageStatusPredecessors(to string) []string {
+	var from []string
+	for status := range messageStatusTransitions {
+		if CanTransitionMessageStatus(status, to) {
+			from = append(from, status)
+		}
+	}
+	return from
+}
+
 type Message struct {
 	gorm.Model
-	MessageID      string    `json:"message_id" gorm:"primaryKey"` // Message ID (as string)
-	ConversationID string    `json:"conversation_id"`              // Conversation ID (as string)
-	SenderID       string    `json:"sender_id"`                    // Sender User ID (as uint)
-	ReceiverID     string    `json:"receiver_id"`                  // Receiver User ID (as uint)
-	GroupID        string    `json:"group_id,omitempty"`
-	Type           string    `json:"type"`
-	IsRead         bool      `json:"is_read" gorm:"default:false"` // 是否已读
-	Content        string    `json:"content"`                      // Message content
-	MessageType    string    `json:"message_type"`                 // Message type (text, image, etc.)
-	Status         string    `json:"status"`                       // Message status (sent, read, etc.)
-	CreatedAt      time.Time `json:"created_at"`
+	ID                          uint       `gorm:"primaryKey;index:idx_conversation_message,priority:2"`                              // 覆盖 gorm.Model.ID，参与会话分页的复合索引
+	MessageID                   string     `json:"message_id" gorm:"primaryKey"`                                                      // Message ID (as string)
+	ConversationID              string     `json:"conversation_id" gorm:"type:varchar(36);index:idx_conversation_message,priority:1"` // Conversation ID (as string)
+	SenderID                    string     `json:"sender_id"`                                                                         // Sender User ID (as uint)
+	ReceiverID                  string     `json:"receiver_id"`                                                                       // Receiver User ID (as uint)
+	GroupID                     string     `json:"group_id,omitempty"`
+	Type                        string     `json:"type"`
+	IsRead                      bool       `json:"is_read" gorm:"default:false"`                                     // 是否已读
+	Content                     string     `json:"content"`                                                          // Message content
+	MessageType                 string     `json:"message_type"`                                                     // Message type (text, image, etc.)
+	Status                      string     `json:"status"`                                                           // Message status, see MessageStatus*
+	ClientMsgID                 string     `json:"client_msg_id,omitempty" gorm:"type:varchar(64)"`                  // 客户端生成的幂等 ID
+	DedupKey                    *string    `json:"-" gorm:"type:varchar(110);uniqueIndex"`                           // sender_id:client_msg_id，保证同一发送者不重复落库
+	Edited                      bool       `json:"edited" gorm:"default:false"`                                      // 是否被编辑过
+	EditedAt                    *time.Time `json:"edited_at"`                                                        // 最后一次编辑时间
+	Recalled                    bool       `json:"recalled" gorm:"default:false"`                                    // 是否已撤回，撤回后内容清空
+	RecalledAt                  *time.Time `json:"recalled_at"`                                                      // 撤回时间
+	ReplyToID                   *uint      `json:"reply_to_id,omitempty" gorm:"index"`                               // 引用回复的消息 ID
+	ThreadRootID                *uint      `json:"thread_root_id,omitempty" gorm:"index"`                            // 所属话题的根消息 ID
+	ForwardedFromMessageID      *uint      `json:"forwarded_from_message_id,omitempty"`                              // 转发的原消息 ID
+	ForwardedFromSenderID       string     `json:"forwarded_from_sender_id,omitempty" gorm:"type:varchar(36)"`       // 原消息发送者
+	ForwardedFromConversationID string     `json:"forwarded_from_conversation_id,omitempty" gorm:"type:varchar(36)"` // 原会话 ID，目标会话成员都能访问原会话时才记录
+	CreatedAt                   time.Time  `json:"created_at"`
 }
@@ -0,0 +1,10 @@
+package models
+
+import "time"
+
+// MessageDeletion 用户“仅对我删除”的消息，只在该用户的历史记录中隐藏
+type MessageDeletion struct {
+	MessageID uint      `gorm:"primaryKey" json:"message_id"`
+	UserID    string    `gorm:"primaryKey;type:varchar(36)" json:"user_id"`
+	DeletedAt time.Time `gorm:"autoCreateTime" json:"deleted_at"`
+}
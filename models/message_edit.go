@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// MessageEdit 消息编辑历史，每次编辑保存编辑前的内容
+type MessageEdit struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	MessageID uint      `gorm:"index" json:"message_id"`           // 被编辑的消息 ID
+	EditorID  string    `gorm:"type:varchar(36)" json:"editor_id"` // 编辑者 ID
+	Content   string    `json:"content"`                           // 编辑前的内容
+	EditedAt  time.Time `gorm:"autoCreateTime" json:"edited_at"`   // 编辑时间
+}
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// MessageMention 群消息中的 @ 记录，@all 会为每个成员各写一条
+type MessageMention struct {
+	ID             uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	MessageID      uint      `gorm:"index" json:"message_id"`
+	ConversationID string    `gorm:"type:varchar(36);index" json:"conversation_id"`
+	UserID         string    `gorm:"type:varchar(36);index" json:"user_id"` // 被 @ 的用户
+	SenderID       string    `gorm:"type:varchar(36)" json:"sender_id"`
+	IsAll          bool      `gorm:"default:false" json:"is_all"` // 是否来自 @all
+	CreatedAt      time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// MessageReaction 消息表情回应，同一用户对同一消息的同一表情只记录一次
+type MessageReaction struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	MessageID uint      `gorm:"uniqueIndex:idx_message_user_emoji" json:"message_id"`
+	UserID    string    `gorm:"type:varchar(36);uniqueIndex:idx_message_user_emoji" json:"user_id"`
+	Emoji     string    `gorm:"type:varchar(32);uniqueIndex:idx_message_user_emoji" json:"emoji"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// PinnedMessage 会话中的置顶消息
+type PinnedMessage struct {
+	ID             uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	ConversationID string    `gorm:"type:varchar(36);index" json:"conversation_id"`
+	MessageID      uint      `gorm:"uniqueIndex" json:"message_id"`
+	PinnedBy       string    `gorm:"type:varchar(36)" json:"pinned_by"` // 置顶操作者
+	PinnedAt       time.Time `gorm:"autoCreateTime" json:"pinned_at"`
+}
@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// RevokedToken 被登出设备使用的登录 token，在自然过期之前一直拒绝
+type RevokedToken struct {
+	TokenID   string    `gorm:"primaryKey;type:varchar(36)" json:"token_id"` // JWT 的 jti
+	UserID    uint      `gorm:"index" json:"user_id"`
+	ExpiresAt time.Time `gorm:"index" json:"expires_at"` // token 过期后记录即可清理
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
@@ -16,8 +16,24 @@ type User struct {
 	AvatarURL string         `json:"avatar_url"`
 	Status    string         `json:"status" gorm:"default:'offline'"`
 	LastLogin *time.Time     `json:"last_login" gorm:"default:NULL"` // 允许 NULL
+	LastSeen  *time.Time     `json:"last_seen" gorm:"default:NULL"`  // 最后一个连接断开的时间
 	Bio       string         `json:"bio"`
 	CreatedAt time.Time      `json:"created_at"`
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"deleted_at"`
+
+	// 自定义状态，过期后视为未设置
+	StatusText      string     `json:"status_text" gorm:"type:varchar(100)"`
+	StatusEmoji     string     `json:"status_emoji" gorm:"type:varchar(32)"`
+	StatusExpiresAt *time.Time `json:"status_expires_at" gorm:"default:NULL"`
+	// 手动开启的免打扰，DNDUntil 为空表示一直开启直到手动关闭
+	DNDEnabled bool       `json:"dnd_enabled"`
+	DNDUntil   *time.Time `json:"dnd_until" gorm:"default:NULL"`
 }
+
+// 在线状态，由 WebSocket 连接自动维护
+const (
+	UserStatusOnline  = "online"
+	UserStatusAway    = "away"
+	UserStatusOffline = "offline"
+)
@@ -12,4 +12,13 @@ type WSConnection struct {
 	ConnectionID string    `json:"connection_id" gorm:"primaryKey"` // 连接ID
 	UserID       uint      `json:"user_id"`                         // 用户ID
 	ConnectedAt  time.Time `json:"connected_at"`                    // 连接时间
+
+	// 设备信息由客户端在握手时通过查询参数上报
+	DeviceID   string `gorm:"type:varchar(64);index" json:"device_id"`
+	DeviceName string `gorm:"type:varchar(100)" json:"device_name"`
+	Platform   string `gorm:"type:varchar(32)" json:"platform"` // 如 ios / android / web / desktop
+	IP         string `gorm:"type:varchar(64)" json:"ip"`
+	UserAgent  string `json:"user_agent"`
+	NodeID     string `gorm:"type:varchar(64);index" json:"node_id"` // 连接所在的服务节点
+	TokenID    string `gorm:"type:varchar(36);index" json:"-"`       // 握手使用的登录 token（jti），登出设备时吊销
 }
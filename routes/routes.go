@@ -1,8 +1,10 @@
 package routes
 
 import (
+	"chat-system/config"
 	"chat-system/controllers"
 	"chat-system/middlewares"
+	"log"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -12,6 +14,10 @@ import (
 func RegisterRoutes() *gin.Engine {
 
 	r := gin.Default()
+	// 只采信受信任代理传来的 X-Forwarded-For，ClientIP 才不会被客户端伪造
+	if err := r.SetTrustedProxies(config.TrustedProxies()); err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
 	// 配置跨域中间件
 	corsConfig := cors.Config{
 		AllowOrigins:     []string{"*"},                                       // 允许的域名，可以是前端地址
@@ -29,13 +35,54 @@ func RegisterRoutes() *gin.Engine {
 
 	protected.POST("/register", controllers.Register) // 绑定注册接口
 	protected.POST("/login", controllers.Login)       // 绑定登录接口
+	// 附件下载使用签名链接鉴权，不经过 token 中间件
+	protected.GET("/attachments/:attachment_id/download", controllers.DownloadAttachment)
+	protected.GET("/attachments/:attachment_id/thumbnails/:size", controllers.DownloadThumbnail)
 
 	{
 		protected.Use(middlewares.TokenAuthMiddleware())
 		protected.GET("/userinfo", controllers.GetUserInfo)
+		protected.POST("/ws-ticket", controllers.IssueWSTicket)
+		protected.GET("/presence", controllers.GetPresence)
+		protected.GET("/devices", controllers.GetMyDevices)
+		protected.DELETE("/devices/:device_id", controllers.SignOutDevice)
+		protected.PUT("/user/status", controllers.UpdateUserStatus)
+		protected.GET("/user/dnd", controllers.GetDNDSettings)
+		protected.PUT("/user/dnd", controllers.UpdateDNDSettings)
 		protected.GET("/conversation", controllers.GetConversation)
 		protected.POST("/createConversation", controllers.CreateConversationHandler)
 		protected.GET("/conversation/:conversation_id", controllers.GetMessagesByConversationID)
+		protected.POST("/conversation/:conversation_id/read", controllers.MarkConversationRead)
+		protected.GET("/conversation/:conversation_id/pins", controllers.GetPinnedMessages)
+		protected.POST("/messages", controllers.SendMessage)
+		protected.POST("/messages/forward", controllers.ForwardMessages)
+		protected.GET("/mentions", controllers.GetMyMentions)
+		protected.GET("/search/messages", controllers.SearchMessages)
+		protected.POST("/attachments", controllers.UploadAttachment)
+		protected.GET("/attachments/:attachment_id", controllers.GetAttachment)
+		protected.GET("/messages/:message_id/read-by", controllers.GetMessageReadBy)
+		protected.PUT("/messages/:message_id", controllers.EditMessage)
+		protected.GET("/messages/:message_id/edits", controllers.GetMessageEdits)
+		protected.GET("/messages/:message_id/thread", controllers.GetThread)
+		protected.POST("/messages/:message_id/recall", controllers.RecallMessage)
+		protected.DELETE("/messages/:message_id", controllers.DeleteMessageForMe)
+		protected.POST("/messages/:message_id/reactions", controllers.AddReaction)
+		protected.DELETE("/messages/:message_id/reactions/:emoji", controllers.RemoveReaction)
+		protected.POST("/messages/:message_id/pin", controllers.PinMessage)
+		protected.DELETE("/messages/:message_id/pin", controllers.UnpinMessage)
+
+		// 群组管理
+		protected.POST("/groups", controllers.CreateGroup)
+		protected.GET("/groups", controllers.GetMyGroups)
+		protected.GET("/groups/:group_id", controllers.GetGroup)
+		protected.PUT("/groups/:group_id", controllers.UpdateGroup)
+		protected.DELETE("/groups/:group_id", controllers.DissolveGroup)
+		protected.POST("/groups/:group_id/members", controllers.AddGroupMembers)
+		protected.DELETE("/groups/:group_id/members/:user_id", controllers.RemoveGroupMember)
+		protected.POST("/groups/:group_id/leave", controllers.LeaveGroup)
+		protected.PUT("/groups/:group_id/members/:user_id/role", controllers.SetGroupMemberRole)
+		protected.POST("/groups/:group_id/transfer", controllers.TransferGroupOwnership)
+		protected.PUT("/groups/:group_id/announcement", controllers.UpdateGroupAnnouncement)
 	}
 
 	return r
@@ -0,0 +1,70 @@
+package search
+
+import (
+	"html"
+	"strings"
+)
+
+// snippetRadius 摘要中命中词前后保留的字符数
+const snippetRadius = 30
+
+// Highlight 截取第一个命中词附近的片段，命中词用 <em> 包裹，其余内容做 HTML 转义
+func Highlight(content string, terms []string) string {
+	runes := []rune(content)
+	lower := []rune(strings.ToLower(content))
+	if len(lower) != len(runes) {
+		// 大小写转换改变了长度（极少见），退化为不区分位置的原文转义
+		return html.EscapeString(content)
+	}
+
+	type span struct{ start, end int }
+	var spans []span
+	for i := 0; i < len(lower); {
+		matched := 0
+		for _, term := range terms {
+			t := []rune(term)
+			if len(t) > matched && i+len(t) <= len(lower) && string(lower[i:i+len(t)]) == term {
+				matched = len(t)
+			}
+		}
+		if matched > 0 {
+			spans = append(spans, span{i, i + matched})
+			i += matched
+		} else {
+			i++
+		}
+	}
+	if len(spans) == 0 {
+		return html.EscapeString(content)
+	}
+
+	start := spans[0].start - snippetRadius
+	if start < 0 {
+		start = 0
+	}
+	end := spans[0].end + snippetRadius
+	if end > len(runes) {
+		end = len(runes)
+	}
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	}
+	pos := start
+	for _, s := range spans {
+		if s.start < start || s.end > end {
+			continue
+		}
+		b.WriteString(html.EscapeString(string(runes[pos:s.start])))
+		b.WriteString("<em>")
+		b.WriteString(html.EscapeString(string(runes[s.start:s.end])))
+		b.WriteString("</em>")
+		pos = s.end
+	}
+	b.WriteString(html.EscapeString(string(runes[pos:end])))
+	if end < len(runes) {
+		b.WriteString("…")
+	}
+	return b.String()
+}
@@ -0,0 +1,35 @@
+package search
+
+import (
+	"chat-system/models"
+	"time"
+)
+
+// Query 消息搜索条件
+type Query struct {
+	Text            string     // 搜索关键词，空格分隔的多个词需同时命中
+	ConversationIDs []string   // 可搜索的会话范围，为空时不返回任何结果
+	SenderID        string     // 按发送者过滤
+	MessageType     string     // 按消息类型过滤
+	From            *time.Time // 创建时间下限（含）
+	To              *time.Time // 创建时间上限（含）
+	ExcludeIDs      []uint     // 不返回的消息（如用户“仅对我删除”的），在计数和分页之前排除
+	Offset          int
+	Limit           int
+}
+
+// Result 命中的消息 ID（按时间倒序）及总数
+type Result struct {
+	MessageIDs []uint
+	Total      int64
+}
+
+// Index 可插拔的消息搜索索引
+type Index interface {
+	// Index 写入或更新一条消息
+	Index(message models.Message) error
+	// Remove 从索引中移除消息（如撤回）
+	Remove(messageID uint) error
+	// Search 按条件检索消息
+	Search(query Query) (*Result, error)
+}
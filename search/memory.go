@@ -0,0 +1,188 @@
+package search
+
+import (
+	"chat-system/models"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// MemoryIndex 进程内倒排索引，不依赖数据库，适合测试和单机开发。
+// 只包含启动后通过 Index 写入的消息。
+type MemoryIndex struct {
+	mu       sync.RWMutex
+	docs     map[uint]memoryDoc
+	postings map[string]map[uint]struct{}
+}
+
+type memoryDoc struct {
+	ConversationID string
+	SenderID       string
+	MessageType    string
+	Content        string // 小写后的内容，用于校验短语命中
+	Tokens         []string
+	CreatedAt      time.Time
+}
+
+func NewMemoryIndex() *MemoryIndex {
+	return &MemoryIndex{
+		docs:     make(map[uint]memoryDoc),
+		postings: make(map[string]map[uint]struct{}),
+	}
+}
+
+func (m *MemoryIndex) Index(message models.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.removeLocked(message.ID)
+	if message.Recalled {
+		return nil
+	}
+
+	doc := memoryDoc{
+		ConversationID: message.ConversationID,
+		SenderID:       message.SenderID,
+		MessageType:    message.MessageType,
+		Content:        strings.ToLower(message.Content),
+		Tokens:         tokenize(message.Content),
+		CreatedAt:      message.CreatedAt,
+	}
+	m.docs[message.ID] = doc
+	for _, token := range doc.Tokens {
+		if m.postings[token] == nil {
+			m.postings[token] = make(map[uint]struct{})
+		}
+		m.postings[token][message.ID] = struct{}{}
+	}
+	return nil
+}
+
+func (m *MemoryIndex) Remove(messageID uint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.removeLocked(messageID)
+	return nil
+}
+
+func (m *MemoryIndex) removeLocked(messageID uint) {
+	doc, ok := m.docs[messageID]
+	if !ok {
+		return
+	}
+	for _, token := range doc.Tokens {
+		delete(m.postings[token], messageID)
+		if len(m.postings[token]) == 0 {
+			delete(m.postings, token)
+		}
+	}
+	delete(m.docs, messageID)
+}
+
+func (m *MemoryIndex) Search(query Query) (*Result, error) {
+	result := &Result{}
+	terms := Terms(query.Text)
+	if len(terms) == 0 || len(query.ConversationIDs) == 0 {
+		return result, nil
+	}
+	conversations := make(map[string]bool, len(query.ConversationIDs))
+	for _, id := range query.ConversationIDs {
+		conversations[id] = true
+	}
+	excluded := make(map[uint]bool, len(query.ExcludeIDs))
+	for _, id := range query.ExcludeIDs {
+		excluded[id] = true
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	// 先用倒排表求交集缩小候选集，再逐条校验短语和过滤条件
+	var candidates map[uint]struct{}
+	for _, term := range terms {
+		for _, token := range tokenize(term) {
+			posting := m.postings[token]
+			if candidates == nil {
+				candidates = make(map[uint]struct{}, len(posting))
+				for id := range posting {
+					candidates[id] = struct{}{}
+				}
+				continue
+			}
+			for id := range candidates {
+				if _, ok := posting[id]; !ok {
+					delete(candidates, id)
+				}
+			}
+		}
+	}
+
+	matched := make([]uint, 0, len(candidates))
+	for id := range candidates {
+		doc := m.docs[id]
+		if !conversations[doc.ConversationID] || excluded[id] ||
+			(query.SenderID != "" && doc.SenderID != query.SenderID) ||
+			(query.MessageType != "" && doc.MessageType != query.MessageType) ||
+			(query.From != nil && doc.CreatedAt.Before(*query.From)) ||
+			(query.To != nil && doc.CreatedAt.After(*query.To)) {
+			continue
+		}
+		containsAll := true
+		for _, term := range terms {
+			if !strings.Contains(doc.Content, term) {
+				containsAll = false
+				break
+			}
+		}
+		if containsAll {
+			matched = append(matched, id)
+		}
+	}
+
+	sort.Slice(matched, func(i, j int) bool { return matched[i] > matched[j] })
+	result.Total = int64(len(matched))
+	if query.Offset < len(matched) {
+		end := len(matched)
+		if query.Limit > 0 && query.Offset+query.Limit < end {
+			end = query.Offset + query.Limit
+		}
+		result.MessageIDs = matched[query.Offset:end]
+	}
+	return result, nil
+}
+
+// Terms 把搜索文本拆成小写的关键词
+func Terms(text string) []string {
+	return strings.Fields(strings.ToLower(text))
+}
+
+// tokenize 拉丁字母和数字按单词切分，中日韩文字逐字切分
+func tokenize(text string) []string {
+	seen := make(map[string]bool)
+	tokens := make([]string, 0)
+	add := func(token string) {
+		if token != "" && !seen[token] {
+			seen[token] = true
+			tokens = append(tokens, token)
+		}
+	}
+
+	var word strings.Builder
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul):
+			add(word.String())
+			word.Reset()
+			add(string(r))
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			word.WriteRune(r)
+		default:
+			add(word.String())
+			word.Reset()
+		}
+	}
+	add(word.String())
+	return tokens
+}
@@ -0,0 +1,241 @@
+package search
+
+import (
+	"chat-system/models"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var baseTime = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+func newMessage(id uint, conversationID, senderID, messageType, content string, createdAt time.Time) models.Message {
+	message := models.Message{
+		ConversationID: conversationID,
+		SenderID:       senderID,
+		MessageType:    messageType,
+		Content:        content,
+		CreatedAt:      createdAt,
+	}
+	message.ID = id
+	return message
+}
+
+// newTestIndex 两个会话、两个发送者、跨三天的消息
+func newTestIndex(t *testing.T) *MemoryIndex {
+	t.Helper()
+	index := NewMemoryIndex()
+	messages := []models.Message{
+		newMessage(1, "c1", "u1", "text", "Deploy the release tonight", baseTime),
+		newMessage(2, "c1", "u2", "text", "release notes are ready", baseTime.Add(24*time.Hour)),
+		newMessage(3, "c2", "u1", "text", "the release is blocked", baseTime.Add(48*time.Hour)),
+		newMessage(4, "c1", "u1", "file", "release checklist", baseTime.Add(48*time.Hour)),
+		newMessage(5, "c2", "u2", "text", "明天发布新版本", baseTime.Add(48*time.Hour)),
+	}
+	for _, message := range messages {
+		if err := index.Index(message); err != nil {
+			t.Fatalf("Index(%d): %v", message.ID, err)
+		}
+	}
+	return index
+}
+
+func search(t *testing.T, index *MemoryIndex, query Query) []uint {
+	t.Helper()
+	if query.ConversationIDs == nil {
+		query.ConversationIDs = []string{"c1", "c2"}
+	}
+	result, err := index.Search(query)
+	if err != nil {
+		t.Fatalf("Search(%+v): %v", query, err)
+	}
+	if result.MessageIDs == nil {
+		return []uint{}
+	}
+	return result.MessageIDs
+}
+
+func TestMemoryIndexFilters(t *testing.T) {
+	index := newTestIndex(t)
+	from := baseTime.Add(24 * time.Hour)
+	to := baseTime.Add(24 * time.Hour)
+
+	tests := []struct {
+		name  string
+		query Query
+		want  []uint
+	}{
+		{"all conversations", Query{Text: "release"}, []uint{4, 3, 2, 1}},
+		{"conversation", Query{Text: "release", ConversationIDs: []string{"c2"}}, []uint{3}},
+		{"no conversations", Query{Text: "release", ConversationIDs: []string{}}, []uint{}},
+		{"sender", Query{Text: "release", SenderID: "u2"}, []uint{2}},
+		{"type", Query{Text: "release", MessageType: "file"}, []uint{4}},
+		{"from", Query{Text: "release", From: &from}, []uint{4, 3, 2}},
+		{"to", Query{Text: "release", To: &to}, []uint{2, 1}},
+		{"range", Query{Text: "release", From: &from, To: &to}, []uint{2}},
+		{"excluded", Query{Text: "release", ExcludeIDs: []uint{2, 4}}, []uint{3, 1}},
+		{"case insensitive", Query{Text: "DEPLOY"}, []uint{1}},
+		{"empty text", Query{Text: "  "}, []uint{}},
+		{"cjk", Query{Text: "发布"}, []uint{5}},
+		{"cjk phrase must be contiguous", Query{Text: "布发"}, []uint{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := search(t, index, tt.query); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryIndexMultiTermAND(t *testing.T) {
+	index := newTestIndex(t)
+
+	if got, want := search(t, index, Query{Text: "release notes"}), []uint{2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("release notes: got %v, want %v", got, want)
+	}
+	if got, want := search(t, index, Query{Text: "the release"}), []uint{3, 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("the release: got %v, want %v", got, want)
+	}
+	if got := search(t, index, Query{Text: "release missing"}); len(got) != 0 {
+		t.Errorf("release missing: got %v, want none", got)
+	}
+}
+
+func TestMemoryIndexRemoveAndReindex(t *testing.T) {
+	index := newTestIndex(t)
+
+	// 撤回
+	if err := index.Remove(1); err != nil {
+		t.Fatal(err)
+	}
+	if got := search(t, index, Query{Text: "deploy"}); len(got) != 0 {
+		t.Errorf("after remove: got %v, want none", got)
+	}
+	// 撤回后的消息以 Recalled 重新写入时也不应被索引
+	recalled := newMessage(2, "c1", "u2", "text", "release notes are ready", baseTime)
+	recalled.Recalled = true
+	if err := index.Index(recalled); err != nil {
+		t.Fatal(err)
+	}
+	if got := search(t, index, Query{Text: "notes"}); len(got) != 0 {
+		t.Errorf("after recall: got %v, want none", got)
+	}
+
+	// 编辑后旧内容不再命中，新内容可以命中
+	edited := newMessage(3, "c2", "u1", "text", "the rollout is unblocked", baseTime)
+	if err := index.Index(edited); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := search(t, index, Query{Text: "release"}), []uint{4}; !reflect.DeepEqual(got, want) {
+		t.Errorf("old content: got %v, want %v", got, want)
+	}
+	if got, want := search(t, index, Query{Text: "rollout"}), []uint{3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("new content: got %v, want %v", got, want)
+	}
+	if _, ok := index.postings["blocked"]; ok {
+		t.Error("stale posting for edited content was not removed")
+	}
+
+	// 移除不存在的消息不报错
+	if err := index.Remove(999); err != nil {
+		t.Errorf("Remove(999): %v", err)
+	}
+}
+
+func TestMemoryIndexPagination(t *testing.T) {
+	index := newTestIndex(t)
+
+	tests := []struct {
+		offset, limit int
+		want          []uint
+	}{
+		{0, 2, []uint{4, 3}},
+		{2, 2, []uint{2, 1}},
+		{3, 2, []uint{1}},
+		{4, 2, []uint{}},
+		{10, 2, []uint{}},
+		{1, 0, []uint{3, 2, 1}}, // limit 为 0 时不限制
+	}
+	for _, tt := range tests {
+		result, err := index.Search(Query{Text: "release", ConversationIDs: []string{"c1", "c2"}, Offset: tt.offset, Limit: tt.limit})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Total != 4 {
+			t.Errorf("offset %d limit %d: total %d, want 4", tt.offset, tt.limit, result.Total)
+		}
+		got := result.MessageIDs
+		if got == nil {
+			got = []uint{}
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("offset %d limit %d: got %v, want %v", tt.offset, tt.limit, got, tt.want)
+		}
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		terms   []string
+		want    string
+	}{
+		{"short", "Deploy the release", []string{"release"}, "Deploy the <em>release</em>"},
+		{"case preserved", "RELEASE now", []string{"release"}, "<em>RELEASE</em> now"},
+		{"every term", "a b a", []string{"a", "b"}, "<em>a</em> <em>b</em> <em>a</em>"},
+		{"longest term wins", "release", []string{"rel", "release"}, "<em>release</em>"},
+		{"escaped", "<b>release</b>", []string{"release"}, "&lt;b&gt;<em>release</em>&lt;/b&gt;"},
+		{"no match", "<hello>", []string{"x"}, "&lt;hello&gt;"},
+		{"cjk", "我们明天发布新版本", []string{"发布"}, "我们明天<em>发布</em>新版本"},
+		{
+			"leading ellipsis",
+			strings.Repeat("x", 40) + "release",
+			[]string{"release"},
+			"…" + strings.Repeat("x", 30) + "<em>release</em>",
+		},
+		{
+			"trailing ellipsis",
+			"release" + strings.Repeat("y", 40),
+			[]string{"release"},
+			"<em>release</em>" + strings.Repeat("y", 30) + "…",
+		},
+		{
+			"cjk boundaries count runes",
+			strings.Repeat("前", 35) + "发布" + strings.Repeat("后", 35),
+			[]string{"发布"},
+			"…" + strings.Repeat("前", 30) + "<em>发布</em>" + strings.Repeat("后", 30) + "…",
+		},
+		{
+			"match outside snippet is not wrapped",
+			"release" + strings.Repeat("z", 40) + "release",
+			[]string{"release"},
+			"<em>release</em>" + strings.Repeat("z", 30) + "…",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Highlight(tt.content, tt.terms); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryIndexExcludeBeforePaging(t *testing.T) {
+	index := newTestIndex(t)
+
+	// 排除的消息不计入总数，分页按排除后的结果计算
+	result, err := index.Search(Query{Text: "release", ConversationIDs: []string{"c1", "c2"}, ExcludeIDs: []uint{4}, Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Total != 3 {
+		t.Errorf("total %d, want 3", result.Total)
+	}
+	if want := []uint{3, 2}; !reflect.DeepEqual(result.MessageIDs, want) {
+		t.Errorf("got %v, want %v", result.MessageIDs, want)
+	}
+}
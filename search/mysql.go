@@ -0,0 +1,83 @@
+package search
+
+import (
+	"chat-system/models"
+	"fmt"
+	"log"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+const fulltextIndexName = "idx_messages_content_fulltext"
+
+// MySQLIndex 基于 MySQL FULLTEXT（ngram 分词，支持中文）的索引，
+// 数据由 messages 表本身维护，Index / Remove 无需额外操作
+type MySQLIndex struct {
+	db *gorm.DB
+}
+
+// NewMySQLIndex 创建 MySQL 索引，必要时为 messages.content 建立 FULLTEXT 索引
+func NewMySQLIndex(db *gorm.DB) *MySQLIndex {
+	var count int64
+	db.Raw("SELECT COUNT(*) FROM information_schema.statistics WHERE table_schema = DATABASE() AND table_name = 'messages' AND index_name = ?", fulltextIndexName).
+		Scan(&count)
+	if count == 0 {
+		if err := db.Exec(fmt.Sprintf("ALTER TABLE messages ADD FULLTEXT INDEX %s (content) WITH PARSER ngram", fulltextIndexName)).Error; err != nil {
+			log.Println("Failed to create fulltext index:", err)
+		}
+	}
+	return &MySQLIndex{db: db}
+}
+
+func (m *MySQLIndex) Index(message models.Message) error {
+	return nil
+}
+
+func (m *MySQLIndex) Remove(messageID uint) error {
+	return nil
+}
+
+func (m *MySQLIndex) Search(query Query) (*Result, error) {
+	result := &Result{}
+	terms := Terms(query.Text)
+	if len(terms) == 0 || len(query.ConversationIDs) == 0 {
+		return result, nil
+	}
+
+	db := m.db.Model(&models.Message{}).
+		Where("MATCH(content) AGAINST(? IN BOOLEAN MODE)", booleanQuery(terms)).
+		Where("conversation_id IN ? AND recalled = false", query.ConversationIDs)
+	if query.SenderID != "" {
+		db = db.Where("sender_id = ?", query.SenderID)
+	}
+	if query.MessageType != "" {
+		db = db.Where("message_type = ?", query.MessageType)
+	}
+	if query.From != nil {
+		db = db.Where("created_at >= ?", *query.From)
+	}
+	if query.To != nil {
+		db = db.Where("created_at <= ?", *query.To)
+	}
+	if len(query.ExcludeIDs) > 0 {
+		db = db.Where("id NOT IN ?", query.ExcludeIDs)
+	}
+
+	if err := db.Count(&result.Total).Error; err != nil {
+		return nil, fmt.Errorf("failed to count search results: %w", err)
+	}
+	if err := db.Order("id DESC").Offset(query.Offset).Limit(query.Limit).Pluck("id", &result.MessageIDs).Error; err != nil {
+		return nil, fmt.Errorf("failed to search messages: %w", err)
+	}
+	return result, nil
+}
+
+// booleanQuery 每个词作为必须命中的短语，去掉会破坏 BOOLEAN MODE 语法的引号
+func booleanQuery(terms []string) string {
+	parts := make([]string, 0, len(terms))
+	for _, term := range terms {
+		parts = append(parts, `+"`+strings.ReplaceAll(term, `"`, "")+`"`)
+	}
+	return strings.Join(parts, " ")
+}
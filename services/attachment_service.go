@@ -0,0 +1,428 @@
+package services
+
+import (
+	"bytes"
+	"chat-system/config"
+	"chat-system/models"
+	"chat-system/storage"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// maxMessageAttachments 单条消息最多引用的附件数
+	maxMessageAttachments = 10
+	// attachmentURLTTL 签名下载链接的有效期
+	attachmentURLTTL = time.Hour
+)
+
+// allowedMimePrefixes 允许上传的文件类型（按嗅探结果匹配前缀）。
+// 图片只接受能去掉元数据或本身不带元数据的格式
+var allowedMimePrefixes = []string{
+	"image/jpeg",
+	"image/png",
+	"image/gif",
+	"image/webp",
+	"image/bmp",
+	"image/x-icon",
+	"video/",
+	"audio/",
+	"text/plain",
+	"application/pdf",
+	"application/zip",
+	"application/x-gzip",
+}
+
+var (
+	ErrAttachmentTooLarge       = errors.New("attachment exceeds the size limit")
+	ErrAttachmentEmpty          = errors.New("attachment is empty")
+	ErrAttachmentTypeNotAllowed = errors.New("attachment type is not allowed")
+	ErrInvalidImage             = errors.New("image is corrupted or truncated")
+	ErrAttachmentNotFound       = errors.New("attachment not found")
+	ErrAttachmentUnavailable    = errors.New("attachment not found or already attached to a message")
+	ErrTooManyAttachments       = fmt.Errorf("a message can carry at most %d attachments", maxMessageAttachments)
+	ErrInvalidAttachmentURL     = errors.New("invalid or expired download link")
+)
+
+// FileStorage 附件文件存储，由 InitStorage 创建
+var FileStorage storage.Storage
+
+// InitStorage 初始化附件存储，目前只有本地文件系统实现
+func InitStorage() error {
+	local, err := storage.NewLocalStorage(config.UploadDir())
+	if err != nil {
+		return fmt.Errorf("failed to init upload dir: %w", err)
+	}
+	FileStorage = local
+	return nil
+}
+
+// AttachmentView 返回给客户端的附件信息，附带签名下载链接
+type AttachmentView struct {
+	models.Attachment
+	URL          string                   `json:"url"`
+	URLExpiresAt time.Time                `json:"url_expires_at"`
+	Thumbnails   map[string]ThumbnailView `json:"thumbnails,omitempty"` // 按尺寸名索引，仅图片有
+}
+
+// UploadAttachment 保存上传的文件并记录元数据，文件类型以内容嗅探结果为准
+func UploadAttachment(uploaderID, fileName string, r io.Reader) (*AttachmentView, error) {
+	maxSize := config.MaxUploadSize()
+	data, err := io.ReadAll(io.LimitReader(r, maxSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read upload: %w", err)
+	}
+	if int64(len(data)) > maxSize {
+		return nil, ErrAttachmentTooLarge
+	}
+	if len(data) == 0 {
+		return nil, ErrAttachmentEmpty
+	}
+
+	mimeType := sniffMimeType(data)
+	if !isAllowedMimeType(mimeType) {
+		return nil, ErrAttachmentTypeNotAllowed
+	}
+
+	// 图片先去掉 EXIF 再计算校验和，保存的文件里不再含拍摄位置；无法解析的图片直接拒绝
+	var processed processedImage
+	switch {
+	case isProcessableImage(mimeType):
+		if processed, err = processImage(data, mimeType); err != nil {
+			return nil, ErrInvalidImage
+		}
+		data = processed.Data
+	case mimeType == "image/webp":
+		// 标准库不能解码 WebP，只去掉元数据块，不生成缩略图
+		if data, err = stripWebPMetadata(data); err != nil {
+			return nil, ErrInvalidImage
+		}
+	}
+
+	checksum := sha256.Sum256(data)
+	attachmentID := uuid.New().String()
+	attachment := models.Attachment{
+		AttachmentID: attachmentID,
+		UploaderID:   uploaderID,
+		FileName:     sanitizeFileName(fileName),
+		MimeType:     mimeType,
+		Size:         int64(len(data)),
+		Checksum:     hex.EncodeToString(checksum[:]),
+		StorageKey:   time.Now().Format("2006/01/02/") + attachmentID,
+		Width:        processed.Width,
+		Height:       processed.Height,
+	}
+
+	if err := FileStorage.Save(attachment.StorageKey, bytes.NewReader(data)); err != nil {
+		return nil, fmt.Errorf("failed to store attachment: %w", err)
+	}
+	if err := config.DB.Create(&attachment).Error; err != nil {
+		if err := FileStorage.Delete(attachment.StorageKey); err != nil {
+			log.Println("Failed to clean up attachment file:", err)
+		}
+		return nil, fmt.Errorf("failed to save attachment: %w", err)
+	}
+
+	var thumbnails []models.AttachmentThumbnail
+	if processed.Image != nil {
+		thumbnails = generateThumbnails(&attachment, processed.Image)
+	}
+	view := newAttachmentView(attachment, thumbnails)
+	return &view, nil
+}
+
+// sniffMimeType 根据文件头判断类型，去掉 charset 等参数
+func sniffMimeType(data []byte) string {
+	detected := http.DetectContentType(data)
+	if mediaType, _, err := mime.ParseMediaType(detected); err == nil {
+		return mediaType
+	}
+	return detected
+}
+
+func isAllowedMimeType(mimeType string) bool {
+	for _, prefix := range allowedMimePrefixes {
+		if strings.HasPrefix(mimeType, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// sanitizeFileName 只保留文件名部分，避免客户端传入路径
+func sanitizeFileName(fileName string) string {
+	fileName = strings.ReplaceAll(fileName, "\\", "/")
+	if i := strings.LastIndex(fileName, "/"); i >= 0 {
+		fileName = fileName[i+1:]
+	}
+	fileName = strings.TrimSpace(fileName)
+	if fileName == "" || fileName == "." || fileName == ".." {
+		return "file"
+	}
+	if len(fileName) > 255 {
+		fileName = fileName[:255]
+	}
+	return fileName
+}
+
+// loadUnlinkedAttachments 查询发送者自己上传且尚未被任何消息引用的附件，按传入顺序返回。
+// 这里只做预检查，真正的占用在 linkAttachments 中以条件更新完成
+func loadUnlinkedAttachments(uploaderID string, attachmentIDs []string) ([]models.Attachment, error) {
+	ids := make([]string, 0, len(attachmentIDs))
+	for _, id := range attachmentIDs {
+		if !containsID(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) > maxMessageAttachments {
+		return nil, ErrTooManyAttachments
+	}
+
+	var attachments []models.Attachment
+	if err := config.DB.
+		Where("attachment_id IN ? AND uploader_id = ? AND attached_at IS NULL", ids, uploaderID).
+		Find(&attachments).Error; err != nil {
+		return nil, fmt.Errorf("failed to load attachments: %w", err)
+	}
+	if len(attachments) != len(ids) {
+		return nil, ErrAttachmentUnavailable
+	}
+
+	byID := make(map[string]models.Attachment, len(attachments))
+	for _, attachment := range attachments {
+		byID[attachment.AttachmentID] = attachment
+	}
+	ordered := make([]models.Attachment, 0, len(ids))
+	for _, id := range ids {
+		ordered = append(ordered, byID[id])
+	}
+	return ordered, nil
+}
+
+// linkAttachments 在消息所在的事务中记录引用的附件。
+// 新附件以 attached_at 为空作为条件占用，并发发送同一附件时只有一条消息能成功；
+// 转发沿用的附件已被占用，直接引用
+func linkAttachments(tx *gorm.DB, messageID uint, attachments []models.Attachment) error {
+	if len(attachments) == 0 {
+		return nil
+	}
+	unclaimed := make([]uint, 0, len(attachments))
+	links := make([]models.MessageAttachment, 0, len(attachments))
+	for i, attachment := range attachments {
+		if attachment.AttachedAt == nil {
+			unclaimed = append(unclaimed, attachment.ID)
+		}
+		links = append(links, models.MessageAttachment{MessageID: messageID, AttachmentID: attachment.ID, Position: i})
+	}
+
+	if len(unclaimed) > 0 {
+		result := tx.Model(&models.Attachment{}).
+			Where("id IN ? AND attached_at IS NULL", unclaimed).
+			Update("attached_at", time.Now())
+		if result.Error != nil {
+			return fmt.Errorf("failed to claim attachments: %w", result.Error)
+		}
+		if result.RowsAffected != int64(len(unclaimed)) {
+			return ErrAttachmentUnavailable
+		}
+	}
+	if err := tx.Create(&links).Error; err != nil {
+		return fmt.Errorf("failed to link attachments: %w", err)
+	}
+	return nil
+}
+
+// unlinkMessageAttachments 在撤回事务中解除消息对附件的引用。
+// 不再被任何消息引用的附件连同缩略图记录一起删除，返回需要在事务提交后删除的存储 key；
+// 仍被转发副本引用的附件保留，attached_at 不清空，因此不能再用于新消息
+func unlinkMessageAttachments(tx *gorm.DB, messageID uint) ([]string, error) {
+	var attachmentIDs []uint
+	if err := tx.Model(&models.MessageAttachment{}).Where("message_id = ?", messageID).
+		Pluck("attachment_id", &attachmentIDs).Error; err != nil {
+		return nil, err
+	}
+	if len(attachmentIDs) == 0 {
+		return nil, nil
+	}
+	if err := tx.Where("message_id = ?", messageID).Delete(&models.MessageAttachment{}).Error; err != nil {
+		return nil, err
+	}
+
+	var orphaned []models.Attachment
+	if err := tx.Where("id IN ?", attachmentIDs).
+		Where("NOT EXISTS (SELECT 1 FROM message_attachments WHERE message_attachments.attachment_id = attachments.id)").
+		Find(&orphaned).Error; err != nil {
+		return nil, err
+	}
+	if len(orphaned) == 0 {
+		return nil, nil
+	}
+
+	orphanedIDs := make([]uint, 0, len(orphaned))
+	keys := make([]string, 0, len(orphaned)*(len(thumbnailSizes)+1))
+	for _, attachment := range orphaned {
+		orphanedIDs = append(orphanedIDs, attachment.ID)
+		keys = append(keys, attachment.StorageKey)
+	}
+	var thumbnailKeys []string
+	if err := tx.Model(&models.AttachmentThumbnail{}).Where("attachment_id IN ?", orphanedIDs).
+		Pluck("storage_key", &thumbnailKeys).Error; err != nil {
+		return nil, err
+	}
+	keys = append(keys, thumbnailKeys...)
+
+	if err := tx.Where("attachment_id IN ?", orphanedIDs).Delete(&models.AttachmentThumbnail{}).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Where("id IN ?", orphanedIDs).Delete(&models.Attachment{}).Error; err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// deleteStoredFiles 删除存储中的文件，失败只记录日志
+func deleteStoredFiles(keys []string) {
+	for _, key := range keys {
+		if err := FileStorage.Delete(key); err != nil {
+			log.Println("Failed to delete stored file:", key, err)
+		}
+	}
+}
+
+// loadAttachmentsByMessage 批量查询消息引用的附件，按消息内顺序排列
+func loadAttachmentsByMessage(messageIDs []uint) map[uint][]models.Attachment {
+	result := make(map[uint][]models.Attachment)
+	if len(messageIDs) == 0 {
+		return result
+	}
+
+	var rows []struct {
+		models.Attachment
+		LinkedMessageID uint
+	}
+	if err := config.DB.Table("message_attachments").
+		Select("attachments.*, message_attachments.message_id AS linked_message_id").
+		Joins("JOIN attachments ON attachments.id = message_attachments.attachment_id").
+		Where("message_attachments.message_id IN ?", messageIDs).
+		Order("message_attachments.message_id, message_attachments.position").
+		Scan(&rows).Error; err != nil {
+		log.Println("Failed to load message attachments:", err)
+		return result
+	}
+	for _, row := range rows {
+		result[row.LinkedMessageID] = append(result[row.LinkedMessageID], row.Attachment)
+	}
+	return result
+}
+
+// newAttachmentView 组装附件视图并签发原图和缩略图的下载链接
+func newAttachmentView(attachment models.Attachment, thumbnails []models.AttachmentThumbnail) AttachmentView {
+	link, expiresAt := SignAttachmentURL(attachment.AttachmentID)
+	view := AttachmentView{Attachment: attachment, URL: link, URLExpiresAt: expiresAt}
+	for _, thumbnail := range thumbnails {
+		if view.Thumbnails == nil {
+			view.Thumbnails = make(map[string]ThumbnailView, len(thumbnails))
+		}
+		view.Thumbnails[thumbnail.Size] = ThumbnailView{
+			URL:    signAttachmentResource(attachment.AttachmentID+"/thumbnails/"+thumbnail.Size, expiresAt),
+			Width:  thumbnail.Width,
+			Height: thumbnail.Height,
+		}
+	}
+	return view
+}
+
+// SignAttachmentURL 生成带过期时间和 HMAC 签名的下载链接，持有链接即可下载
+func SignAttachmentURL(attachmentID string) (string, time.Time) {
+	expiresAt := time.Now().Add(attachmentURLTTL).Truncate(time.Second)
+	return signAttachmentResource(attachmentID+"/download", expiresAt), expiresAt
+}
+
+// signAttachmentResource 为 /api/attachments/ 下的路径签名，resource 形如 "<id>/download"
+func signAttachmentResource(resource string, expiresAt time.Time) string {
+	expires := strconv.FormatInt(expiresAt.Unix(), 10)
+	query := url.Values{}
+	query.Set("expires", expires)
+	query.Set("signature", attachmentSignature(resource, expires))
+	return "/api/attachments/" + resource + "?" + query.Encode()
+}
+
+// VerifyAttachmentURL 校验下载链接的签名和有效期，resource 与签名时一致
+func VerifyAttachmentURL(resource, expires, signature string) error {
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > expiresAt {
+		return ErrInvalidAttachmentURL
+	}
+	expected := attachmentSignature(resource, expires)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return ErrInvalidAttachmentURL
+	}
+	return nil
+}
+
+func attachmentSignature(resource, expires string) string {
+	mac := hmac.New(sha256.New, jwtKey)
+	mac.Write([]byte("attachment:" + resource + ":" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// GetAttachmentByID 根据对外 ID 查询附件
+func GetAttachmentByID(attachmentID string) (*models.Attachment, error) {
+	var attachment models.Attachment
+	if err := config.DB.Where("attachment_id = ?", attachmentID).First(&attachment).Error; err != nil {
+		return nil, ErrAttachmentNotFound
+	}
+	return &attachment, nil
+}
+
+// GetAttachmentForUser 上传者或能看到引用该附件的消息的用户可以获取附件信息
+func GetAttachmentForUser(attachmentID, userID string) (*AttachmentView, error) {
+	attachment, err := GetAttachmentByID(attachmentID)
+	if err != nil {
+		return nil, err
+	}
+
+	if attachment.UploaderID != userID {
+		var count int64
+		if err := config.DB.Table("message_attachments").
+			Joins("JOIN messages ON messages.id = message_attachments.message_id").
+			Where("message_attachments.attachment_id = ?", attachment.ID).
+			Where("messages.conversation_id IN (?)", UserConversationIDsQuery(userID)).
+			Count(&count).Error; err != nil {
+			return nil, fmt.Errorf("failed to check attachment access: %w", err)
+		}
+		if count == 0 {
+			return nil, ErrAttachmentNotFound
+		}
+	}
+
+	view := newAttachmentView(*attachment, loadThumbnails([]uint{attachment.ID})[attachment.ID])
+	return &view, nil
+}
+
+// OpenAttachment 打开附件内容，调用方负责关闭
+func OpenAttachment(attachmentID string) (*models.Attachment, io.ReadCloser, error) {
+	attachment, err := GetAttachmentByID(attachmentID)
+	if err != nil {
+		return nil, nil, err
+	}
+	reader, err := FileStorage.Open(attachment.StorageKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open attachment: %w", err)
+	}
+	return attachment, reader, nil
+}
@@ -0,0 +1,42 @@
+package services
+
+import (
+	"chat-system/config"
+	"chat-system/models"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// GetConversationByID 根据会话 ID 查询会话
+func GetConversationByID(conversationID string) (*models.Conversation, error) {
+	var conversation models.Conversation
+	if err := config.DB.Where("conversation_id = ?", conversationID).First(&conversation).Error; err != nil {
+		return nil, fmt.Errorf("conversation not found: %w", err)
+	}
+	return &conversation, nil
+}
+
+// GetConversationMemberIDs 返回会话的全部成员：私聊为双方，群聊为群成员
+func GetConversationMemberIDs(conversation *models.Conversation) ([]string, error) {
+	if conversation.GroupID != "" {
+		return GetGroupMemberIDs(conversation.GroupID)
+	}
+	return []string{conversation.ParticipantA, conversation.ParticipantB}, nil
+}
+
+// IsConversationMember 判断用户是否是会话成员
+func IsConversationMember(conversation *models.Conversation, userID string) (bool, error) {
+	if conversation.GroupID != "" {
+		return IsGroupMember(conversation.GroupID, userID)
+	}
+	return conversation.ParticipantA == userID || conversation.ParticipantB == userID, nil
+}
+
+// UserConversationIDsQuery 返回用户所属全部会话 ID 的子查询（私聊参与者 + 所在群的群聊）
+func UserConversationIDsQuery(userID string) *gorm.DB {
+	groupIDs := config.DB.Model(&models.GroupMember{}).Select("group_id").Where("user_id = ?", userID)
+	return config.DB.Model(&models.Conversation{}).
+		Select("conversation_id").
+		Where("participant_a = ? OR participant_b = ? OR group_id IN (?)", userID, userID, groupIDs)
+}
@@ -0,0 +1,218 @@
+package services
+
+import (
+	"chat-system/config"
+	"chat-system/models"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"gorm.io/gorm/clause"
+)
+
+// CloseSignedOut 设备被用户从其他设备登出时使用的关闭码（4000-4999 为应用自定义）
+const CloseSignedOut = 4001
+
+var ErrDeviceNotFound = errors.New("device not found")
+
+// DeviceView 一个设备及其当前的连接数
+type DeviceView struct {
+	DeviceID    string    `json:"device_id"`
+	DeviceName  string    `json:"device_name"`
+	Platform    string    `json:"platform"`
+	IP          string    `json:"ip"`
+	ConnectedAt time.Time `json:"connected_at"` // 该设备最早的连接时间
+	Connections int       `json:"connections"`
+}
+
+// newClient 根据握手请求创建连接，未上报 device_id 的客户端每个连接视为一个独立设备
+func newClient(conn *websocket.Conn, user *models.User, tokenID string, r *http.Request) *Client {
+	query := r.URL.Query()
+	client := &Client{
+		Conn:         conn,
+		Send:         make(chan []byte),
+		ID:           fmt.Sprint(user.ID),
+		LastPing:     time.Now(), // 初始化心跳时间
+		ConnectionID: uuid.New().String(),
+		DeviceID:     truncate(query.Get("device_id"), 64),
+		DeviceName:   truncate(query.Get("device_name"), 100),
+		Platform:     truncate(query.Get("platform"), 32),
+		ConnectedAt:  time.Now(),
+		TokenID:      tokenID,
+	}
+	if client.DeviceID == "" {
+		client.DeviceID = client.ConnectionID
+	}
+	return client
+}
+
+// saveConnection 记录活跃连接，供设备列表查询。IP 取自 gin 按受信任代理配置解析的 ClientIP
+func saveConnection(client *Client, ctx *gin.Context) {
+	userID, _ := strconv.ParseUint(client.ID, 10, 64)
+	connection := models.WSConnection{
+		ConnectionID: client.ConnectionID,
+		UserID:       uint(userID),
+		ConnectedAt:  client.ConnectedAt,
+		DeviceID:     client.DeviceID,
+		DeviceName:   client.DeviceName,
+		Platform:     client.Platform,
+		IP:           truncate(ctx.ClientIP(), 64),
+		NodeID:       Manager.nodeID,
+		TokenID:      client.TokenID,
+		UserAgent:    truncate(ctx.Request.UserAgent(), 255),
+	}
+	if err := config.DB.Create(&connection).Error; err != nil {
+		log.Println("Failed to save connection:", err)
+	}
+}
+
+// removeConnection 连接断开后删除记录。WSConnection 带软删除字段，这里直接物理删除，避免表无限增长
+func removeConnection(client *Client) {
+	if err := config.DB.Unscoped().Where("connection_id = ?", client.ConnectionID).Delete(&models.WSConnection{}).Error; err != nil {
+		log.Println("Failed to remove connection:", err)
+	}
+}
+
+// ResetConnections 服务启动时清理本节点上次运行残留的连接记录，以及之前软删除留下的记录，需在 InitBus 之后调用
+func ResetConnections() {
+	if err := config.DB.Unscoped().Where("node_id = ? OR deleted_at IS NOT NULL", Manager.nodeID).Delete(&models.WSConnection{}).Error; err != nil {
+		log.Println("Failed to reset connections:", err)
+	}
+}
+
+// GetUserDevices 按设备汇总用户当前的连接
+func GetUserDevices(userID uint) ([]DeviceView, error) {
+	var connections []models.WSConnection
+	if err := config.DB.Where("user_id = ?", userID).Order("connected_at ASC").Find(&connections).Error; err != nil {
+		return nil, fmt.Errorf("failed to load devices: %w", err)
+	}
+
+	devices := make([]DeviceView, 0)
+	index := make(map[string]int)
+	for _, connection := range connections {
+		if i, ok := index[connection.DeviceID]; ok {
+			devices[i].Connections++
+			continue
+		}
+		index[connection.DeviceID] = len(devices)
+		devices = append(devices, DeviceView{
+			DeviceID:    connection.DeviceID,
+			DeviceName:  connection.DeviceName,
+			Platform:    connection.Platform,
+			IP:          connection.IP,
+			ConnectedAt: connection.ConnectedAt,
+			Connections: 1,
+		})
+	}
+	return devices, nil
+}
+
+// SignOutDevice 吊销设备使用的登录 token 并断开它的全部连接，设备无法再用原 token 重连或调用接口
+func SignOutDevice(userID uint, deviceID string) error {
+	var connections []models.WSConnection
+	if err := config.DB.Select("token_id").
+		Where("user_id = ? AND device_id = ?", userID, deviceID).
+		Find(&connections).Error; err != nil {
+		return fmt.Errorf("failed to load device: %w", err)
+	}
+	if len(connections) == 0 {
+		return ErrDeviceNotFound
+	}
+	tokenIDs := make([]string, 0, len(connections))
+	for _, connection := range connections {
+		if connection.TokenID != "" && !containsID(tokenIDs, connection.TokenID) {
+			tokenIDs = append(tokenIDs, connection.TokenID)
+		}
+	}
+	if err := revokeTokens(userID, tokenIDs); err != nil {
+		return err
+	}
+
+	Manager.DisconnectDevice(fmt.Sprint(userID), deviceID, CloseSignedOut, "signed out from another device")
+	return nil
+}
+
+// revokeTokens 记录被吊销的 token，保留到 token 自然过期，同时清理已过期的记录
+func revokeTokens(userID uint, tokenIDs []string) error {
+	if len(tokenIDs) == 0 {
+		return nil
+	}
+	expiresAt := time.Now().Add(tokenTTL)
+	revoked := make([]models.RevokedToken, 0, len(tokenIDs))
+	for _, tokenID := range tokenIDs {
+		revoked = append(revoked, models.RevokedToken{TokenID: tokenID, UserID: userID, ExpiresAt: expiresAt})
+	}
+	if err := config.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&revoked).Error; err != nil {
+		return fmt.Errorf("failed to revoke device token: %w", err)
+	}
+	if err := config.DB.Where("expires_at < ?", time.Now()).Delete(&models.RevokedToken{}).Error; err != nil {
+		log.Println("Failed to clean up revoked tokens:", err)
+	}
+	return nil
+}
+
+// isTokenRevoked 判断 token 是否属于已登出的设备
+func isTokenRevoked(tokenID string) bool {
+	var count int64
+	config.DB.Model(&models.RevokedToken{}).Where("token_id = ?", tokenID).Count(&count)
+	return count > 0
+}
+
+// DisconnectDevice 以指定关闭码关闭用户某个设备的连接（包括其他节点上的），读循环退出后走正常的注销流程
+func (m *WSManager) DisconnectDevice(userID, deviceID string, code int, reason string) {
+	routes := m.locateAll([]string{userID})
+	remoteNodes := make([]string, 0, len(routes.remote))
+	for nodeID := range routes.remote {
+		remoteNodes = append(remoteNodes, nodeID)
+	}
+	m.forward(remoteNodes, clusterEnvelope{
+		Kind:     clusterDisconnectDevice,
+		UserID:   userID,
+		DeviceID: deviceID,
+		Code:     code,
+		Reason:   reason,
+	})
+	m.disconnectLocalDevice(userID, deviceID, code, reason)
+}
+
+// disconnectLocalDevice 关闭本节点上该设备的连接
+func (m *WSManager) disconnectLocalDevice(userID, deviceID string, code int, reason string) {
+	m.mu.Lock()
+	clients := append([]*Client(nil), m.clients[userID]...)
+	m.mu.Unlock()
+
+	for _, client := range clients {
+		if client.DeviceID == deviceID {
+			client.closeWithCode(code, reason)
+		}
+	}
+}
+
+// closeWithCode 发送关闭帧后关闭底层连接
+func (c *Client) closeWithCode(code int, reason string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.Conn == nil {
+		return
+	}
+	closeMsg := websocket.FormatCloseMessage(code, reason)
+	c.Conn.WriteControl(websocket.CloseMessage, closeMsg, time.Now().Add(time.Second))
+	c.Conn.Close()
+}
+
+// truncate 按字节截断字符串，不会截断在多字节字符中间
+func truncate(value string, limit int) string {
+	if len(value) <= limit {
+		return value
+	}
+	for limit > 0 && value[limit]&0xC0 == 0x80 {
+		limit--
+	}
+	return value[:limit]
+}
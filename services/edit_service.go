@@ -0,0 +1,121 @@
+package services
+
+import (
+	"chat-system/config"
+	"chat-system/models"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrMessageNotFound     = errors.New("message not found")
+	ErrNotMessageSender    = errors.New("only the sender can modify this message")
+	ErrEditWindowExpired   = errors.New("message can no longer be edited")
+	ErrEmptyMessageContent = errors.New("message content cannot be empty")
+)
+
+// GetMessageByID 根据自增 ID 查询消息
+func GetMessageByID(messageID uint) (*models.Message, error) {
+	var message models.Message
+	if err := config.DB.Where("id = ?", messageID).First(&message).Error; err != nil {
+		return nil, ErrMessageNotFound
+	}
+	return &message, nil
+}
+
+// EditMessage 编辑消息内容：仅发送者在允许的时间窗口内可编辑，旧内容写入编辑历史
+func EditMessage(editorID string, messageID uint, content string) (*models.Message, error) {
+	if strings.TrimSpace(content) == "" {
+		return nil, ErrEmptyMessageContent
+	}
+	message, err := GetMessageByID(messageID)
+	if err != nil {
+		return nil, err
+	}
+	if message.SenderID != editorID {
+		return nil, ErrNotMessageSender
+	}
+	if message.Recalled {
+		return nil, ErrMessageRecalled
+	}
+	if time.Since(message.CreatedAt) > config.MessageEditWindow() {
+		return nil, ErrEditWindowExpired
+	}
+	if message.Content == content {
+		return message, nil
+	}
+
+	now := time.Now()
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		history := models.MessageEdit{
+			MessageID: message.ID,
+			EditorID:  editorID,
+			Content:   message.Content,
+		}
+		if err := tx.Create(&history).Error; err != nil {
+			return err
+		}
+		// 只更新未撤回的消息：检查之后才完成的撤回不能被编辑内容覆盖
+		result := tx.Model(&models.Message{}).Where("id = ? AND recalled = ?", message.ID, false).Updates(map[string]interface{}{
+			"content":   content,
+			"edited":    true,
+			"edited_at": now,
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrMessageRecalled
+		}
+		return nil
+	})
+	if errors.Is(err, ErrMessageRecalled) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to edit message: %w", err)
+	}
+
+	message.Content = content
+	message.Edited = true
+	message.EditedAt = &now
+	indexMessage(message)
+	updateMentions(message)
+	notifyConversation(message.ConversationID, EventEdited, EditedEvent{
+		MessageID:      message.ID,
+		ConversationID: message.ConversationID,
+		EditorID:       editorID,
+		Content:        content,
+		EditedAt:       now,
+	})
+	return message, nil
+}
+
+// GetMessageEdits 返回消息的编辑历史，按时间升序
+func GetMessageEdits(messageID uint) ([]models.MessageEdit, error) {
+	var edits []models.MessageEdit
+	if err := config.DB.Where("message_id = ?", messageID).Order("id ASC").Find(&edits).Error; err != nil {
+		return nil, fmt.Errorf("failed to load edit history: %w", err)
+	}
+	return edits, nil
+}
+
+// notifyConversation 向会话的全部成员（包括操作者自己的其他连接）推送事件
+func notifyConversation(conversationID, eventType string, data interface{}) {
+	conversation, err := GetConversationByID(conversationID)
+	if err != nil {
+		log.Println("Failed to notify conversation:", err)
+		return
+	}
+	memberIDs, err := GetConversationMemberIDs(conversation)
+	if err != nil {
+		log.Println("Failed to resolve conversation members:", err)
+		return
+	}
+	Manager.SendEvent(memberIDs, eventType, data)
+}
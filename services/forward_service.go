@@ -0,0 +1,172 @@
+package services
+
+import (
+	"chat-system/config"
+	"chat-system/models"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// maxForwardMessages 单次最多转发的消息数
+const maxForwardMessages = 50
+
+var ErrNothingToForward = errors.New("no messages to forward")
+
+// ForwardSource 转发消息的来源
+type ForwardSource struct {
+	MessageID      uint
+	SenderID       string
+	ConversationID string // 为空表示不向目标会话暴露原会话
+}
+
+// ForwardMessages 把若干条消息按原顺序复制到目标会话，走正常的发送和推送流程。
+// 转发已转发过的消息时保留最初的来源。
+func ForwardMessages(userID string, messageIDs []uint, targetConversationID string) ([]models.Message, error) {
+	if len(messageIDs) == 0 {
+		return nil, ErrNothingToForward
+	}
+	if len(messageIDs) > maxForwardMessages {
+		return nil, fmt.Errorf("cannot forward more than %d messages at once", maxForwardMessages)
+	}
+
+	target, err := GetConversationByID(targetConversationID)
+	if err != nil {
+		return nil, err
+	}
+	targetMembers, err := GetConversationMemberIDs(target)
+	if err != nil {
+		return nil, err
+	}
+
+	uniqueIDs := make([]uint, 0, len(messageIDs))
+	seen := make(map[uint]bool, len(messageIDs))
+	for _, id := range messageIDs {
+		if !seen[id] {
+			seen[id] = true
+			uniqueIDs = append(uniqueIDs, id)
+		}
+	}
+	var sources []models.Message
+	if err := config.DB.Where("id IN ?", uniqueIDs).Order("id ASC").Find(&sources).Error; err != nil {
+		return nil, fmt.Errorf("failed to load messages: %w", err)
+	}
+	// 任何一条不存在都拒绝整个请求，不静默跳过
+	if len(sources) != len(uniqueIDs) {
+		return nil, ErrMessageNotFound
+	}
+
+	// 原会话对目标会话的全部成员都可见时才暴露原会话 ID
+	membersCache := make(map[string][]string)
+	conversationMembers := func(conversationID string) ([]string, error) {
+		if members, ok := membersCache[conversationID]; ok {
+			return members, nil
+		}
+		conversation, err := GetConversationByID(conversationID)
+		if err != nil {
+			return nil, err
+		}
+		members, err := GetConversationMemberIDs(conversation)
+		if err != nil {
+			return nil, err
+		}
+		membersCache[conversationID] = members
+		return members, nil
+	}
+	visibleToTarget := func(conversationID string) bool {
+		members, err := conversationMembers(conversationID)
+		return err == nil && isSubset(targetMembers, members)
+	}
+
+	// 转发者必须能访问每条消息所在的会话
+	for _, source := range sources {
+		if source.Recalled {
+			return nil, ErrMessageRecalled
+		}
+		members, err := conversationMembers(source.ConversationID)
+		if err != nil {
+			return nil, err
+		}
+		if !containsID(members, userID) {
+			return nil, ErrNotConversationMember
+		}
+	}
+
+	sourceIDs := make([]uint, 0, len(sources))
+	for _, source := range sources {
+		sourceIDs = append(sourceIDs, source.ID)
+	}
+	attachments := loadAttachmentsByMessage(sourceIDs)
+
+	// 先全部校验并构造，再在一个事务中落库，避免只转发了一部分
+	forwarded := make([]*models.Message, 0, len(sources))
+	forwardedAttachments := make([][]models.Attachment, 0, len(sources))
+	for _, source := range sources {
+		from := &ForwardSource{MessageID: source.ID, SenderID: source.SenderID, ConversationID: source.ConversationID}
+		if source.ForwardedFromMessageID != nil {
+			from = &ForwardSource{
+				MessageID:      *source.ForwardedFromMessageID,
+				SenderID:       source.ForwardedFromSenderID,
+				ConversationID: source.ForwardedFromConversationID,
+			}
+		}
+		if from.ConversationID != "" && !visibleToTarget(from.ConversationID) {
+			from.ConversationID = ""
+		}
+
+		message, messageAttachments, err := prepareMessage(userID, target, SendMessageInput{
+			ConversationID: target.ConversationID,
+			Content:        source.Content,
+			MessageType:    source.MessageType,
+			ForwardedFrom:  from,
+
+			forwardedAttachments: attachments[source.ID],
+		})
+		if err != nil {
+			return nil, err
+		}
+		forwarded = append(forwarded, message)
+		forwardedAttachments = append(forwardedAttachments, messageAttachments)
+	}
+
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		for i, message := range forwarded {
+			if err := createMessage(tx, message, forwardedAttachments[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to forward messages: %w", err)
+	}
+
+	result := make([]models.Message, 0, len(forwarded))
+	for _, message := range forwarded {
+		indexMessage(message)
+		deliverMessage(target, message, "")
+		result = append(result, *message)
+	}
+	return result, nil
+}
+
+// containsID 判断列表中是否包含该 ID
+func containsID(userIDs []string, userID string) bool {
+	for _, id := range userIDs {
+		if id == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// isSubset 判断 a 中的用户是否都在 b 中
+func isSubset(a, b []string) bool {
+	for _, id := range a {
+		if !containsID(b, id) {
+			return false
+		}
+	}
+	return true
+}
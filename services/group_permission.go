@@ -0,0 +1,91 @@
+package services
+
+import (
+	"chat-system/config"
+	"chat-system/models"
+	"errors"
+)
+
+// GroupPermission 群内操作权限
+type GroupPermission string
+
+const (
+	PermSendMessage GroupPermission = "send_message" // 发送消息
+	PermInvite      GroupPermission = "invite"       // 邀请成员
+	PermKick        GroupPermission = "kick"         // 移除成员
+	PermRename      GroupPermission = "rename"       // 修改群名称、描述
+	PermPin         GroupPermission = "pin"          // 置顶消息
+	PermAnnounce    GroupPermission = "announce"     // 发布群公告
+	PermSetRole     GroupPermission = "set_role"     // 设置管理员
+	PermTransfer    GroupPermission = "transfer"     // 转让群主
+	PermDissolve    GroupPermission = "dissolve"     // 解散群组
+)
+
+// groupRolePermissions 角色权限矩阵
+var groupRolePermissions = map[string]map[GroupPermission]bool{
+	models.GroupRoleOwner: {
+		PermSendMessage: true,
+		PermInvite:      true,
+		PermKick:        true,
+		PermRename:      true,
+		PermPin:         true,
+		PermAnnounce:    true,
+		PermSetRole:     true,
+		PermTransfer:    true,
+		PermDissolve:    true,
+	},
+	models.GroupRoleAdmin: {
+		PermSendMessage: true,
+		PermInvite:      true,
+		PermKick:        true,
+		PermRename:      true,
+		PermPin:         true,
+		PermAnnounce:    true,
+	},
+	models.GroupRoleMember: {
+		PermSendMessage: true,
+	},
+}
+
+var (
+	ErrNotGroupMember   = errors.New("you are not a member of this group")
+	ErrPermissionDenied = errors.New("permission denied")
+)
+
+// RoleHasPermission 判断角色是否拥有某项权限
+func RoleHasPermission(role string, perm GroupPermission) bool {
+	return groupRolePermissions[role][perm]
+}
+
+// groupRoleRank 角色等级，用于判断能否管理其他成员
+var groupRoleRank = map[string]int{
+	models.GroupRoleOwner:  3,
+	models.GroupRoleAdmin:  2,
+	models.GroupRoleMember: 1,
+}
+
+// CanManageMember 只能管理角色等级低于自己的成员（如管理员不能移除其他管理员）
+func CanManageMember(actorRole, targetRole string) bool {
+	return groupRoleRank[actorRole] > groupRoleRank[targetRole]
+}
+
+// GetGroupMember 查询群成员记录
+func GetGroupMember(groupID, userID string) (*models.GroupMember, error) {
+	var member models.GroupMember
+	if err := config.DB.Where("group_id = ? AND user_id = ?", groupID, userID).First(&member).Error; err != nil {
+		return nil, ErrNotGroupMember
+	}
+	return &member, nil
+}
+
+// CheckGroupPermission 校验用户在群内是否拥有某项权限，返回其成员记录
+func CheckGroupPermission(groupID, userID string, perm GroupPermission) (*models.GroupMember, error) {
+	member, err := GetGroupMember(groupID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !RoleHasPermission(member.Role, perm) {
+		return nil, ErrPermissionDenied
+	}
+	return member, nil
+}
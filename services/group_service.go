@@ -0,0 +1,32 @@
+package services
+
+import (
+	"chat-system/config"
+	"chat-system/models"
+	"fmt"
+)
+
+// GetGroupMemberIDs 返回群组全部成员的 user_id
+func GetGroupMemberIDs(groupID string) ([]string, error) {
+	var members []models.GroupMember
+	if err := config.DB.Where("group_id = ?", groupID).Find(&members).Error; err != nil {
+		return nil, fmt.Errorf("failed to load group members: %w", err)
+	}
+
+	memberIDs := make([]string, 0, len(members))
+	for _, member := range members {
+		memberIDs = append(memberIDs, fmt.Sprint(member.UserID))
+	}
+	return memberIDs, nil
+}
+
+// IsGroupMember 判断用户是否属于该群组
+func IsGroupMember(groupID, userID string) (bool, error) {
+	var count int64
+	if err := config.DB.Model(&models.GroupMember{}).
+		Where("group_id = ? AND user_id = ?", groupID, userID).
+		Count(&count).Error; err != nil {
+		return false, fmt.Errorf("failed to check group member: %w", err)
+	}
+	return count > 0, nil
+}
@@ -0,0 +1,411 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/draw"
+	_ "image/gif" // 注册 GIF 解码器
+	"image/jpeg"
+	"image/png"
+	"log"
+)
+
+// maxImagePixels 超过该像素数的图片不解码，避免解压炸弹占满内存
+const maxImagePixels = 40_000_000
+
+// errMalformedImage 图片结构无法解析，无法确认元数据已去掉，调用方应拒绝该文件而不是原样保存
+var errMalformedImage = errors.New("malformed image")
+
+// processedImage 上传图片的处理结果
+type processedImage struct {
+	Data   []byte      // 去掉元数据后的原图
+	Image  *image.RGBA // 已按 EXIF 方向校正的像素，无法解码时为 nil
+	Width  int
+	Height int
+}
+
+// isProcessableImage 标准库能解码的图片类型
+func isProcessableImage(mimeType string) bool {
+	switch mimeType {
+	case "image/jpeg", "image/png", "image/gif":
+		return true
+	}
+	return false
+}
+
+// processImage 去掉 EXIF 等可能含定位信息的元数据，按 EXIF 方向摆正图片并解码出像素用于生成缩略图。
+// 结构无法解析时返回 errMalformedImage；能去掉元数据但解码失败时只是不生成缩略图
+func processImage(data []byte, mimeType string) (processedImage, error) {
+	orientation := 1
+	var err error
+	switch mimeType {
+	case "image/jpeg":
+		data, orientation, err = stripJPEGMetadata(data)
+	case "image/png":
+		data, err = stripPNGMetadata(data)
+	case "image/gif":
+		data, err = stripGIFMetadata(data)
+	}
+	if err != nil {
+		return processedImage{}, err
+	}
+	result := processedImage{Data: data}
+
+	header, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		log.Println("Failed to read image header:", err)
+		return result, nil
+	}
+	result.Width, result.Height = header.Width, header.Height
+	if header.Width*header.Height > maxImagePixels {
+		return result, nil
+	}
+
+	decoded, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		log.Println("Failed to decode image:", err)
+		return result, nil
+	}
+	result.Image = orientImage(toRGBA(decoded), orientation)
+	result.Width, result.Height = result.Image.Bounds().Dx(), result.Image.Bounds().Dy()
+
+	// 方向信息随 EXIF 一起被去掉了，原图需要重新编码成摆正后的样子
+	if orientation != 1 {
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, result.Image, &jpeg.Options{Quality: 90}); err != nil {
+			log.Println("Failed to re-encode image:", err)
+		} else {
+			result.Data = buf.Bytes()
+		}
+	}
+	return result, nil
+}
+
+// stripJPEGMetadata 去掉 APP1（EXIF/XMP）、APP13（IPTC）和 COM 注释段，同时返回 EXIF 中记录的方向
+func stripJPEGMetadata(data []byte) ([]byte, int, error) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil, 0, errMalformedImage
+	}
+
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(data[:2])
+	orientation := 1
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return nil, 0, errMalformedImage
+		}
+		marker := data[i+1]
+		switch {
+		case marker == 0xFF: // 填充字节
+			i++
+			continue
+		case marker == 0xDA || marker == 0xD9: // 图像数据开始或结束，后面原样保留
+			out.Write(data[i:])
+			return out.Bytes(), orientation, nil
+		case marker >= 0xD0 && marker <= 0xD7 || marker == 0x01: // 没有长度字段的标记
+			out.Write(data[i : i+2])
+			i += 2
+			continue
+		}
+
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		end := i + 2 + length
+		if length < 2 || end > len(data) {
+			return nil, 0, errMalformedImage
+		}
+		switch marker {
+		case 0xE1:
+			if o := exifOrientation(data[i+4 : end]); o > 0 {
+				orientation = o
+			}
+		case 0xED, 0xFE: // 丢弃 IPTC 和注释
+		default:
+			out.Write(data[i:end])
+		}
+		i = end
+	}
+	// 没有遇到图像数据就结束了，文件被截断
+	return nil, 0, errMalformedImage
+}
+
+// exifOrientation 从 APP1 段中读取 IFD0 的 Orientation 标签，没有时返回 0
+func exifOrientation(payload []byte) int {
+	if len(payload) < 14 || string(payload[:6]) != "Exif\x00\x00" {
+		return 0
+	}
+	tiff := payload[6:]
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+
+	offset := int(order.Uint32(tiff[4:8]))
+	if offset < 8 || offset+2 > len(tiff) {
+		return 0
+	}
+	count := int(order.Uint16(tiff[offset:]))
+	for k := 0; k < count; k++ {
+		entry := offset + 2 + k*12
+		if entry+12 > len(tiff) {
+			return 0
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			if value := int(order.Uint16(tiff[entry+8:])); value >= 1 && value <= 8 {
+				return value
+			}
+			return 0
+		}
+	}
+	return 0
+}
+
+// stripPNGMetadata 去掉 eXIf 和文本块（XMP 存放在 iTXt 中）
+func stripPNGMetadata(data []byte) ([]byte, error) {
+	const signatureLen = 8
+	if len(data) < signatureLen || string(data[:signatureLen]) != "\x89PNG\r\n\x1a\n" {
+		return nil, errMalformedImage
+	}
+
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(data[:signatureLen])
+	for i := signatureLen; i < len(data); {
+		if i+8 > len(data) {
+			return nil, errMalformedImage
+		}
+		length := int(binary.BigEndian.Uint32(data[i:]))
+		end := i + 12 + length // 长度、类型、数据、CRC
+		if length < 0 || end > len(data) {
+			return nil, errMalformedImage
+		}
+		chunkType := string(data[i+4 : i+8])
+		switch chunkType {
+		case "eXIf", "tEXt", "zTXt", "iTXt": // 丢弃
+		default:
+			out.Write(data[i:end])
+		}
+		i = end
+		if chunkType == "IEND" {
+			return out.Bytes(), nil // IEND 之后的数据不属于图片，一并丢弃
+		}
+	}
+	// 缺少 IEND，文件被截断
+	return nil, errMalformedImage
+}
+
+// stripGIFMetadata 去掉注释扩展和应用扩展（XMP 存放在应用扩展中），只保留控制循环播放的 NETSCAPE2.0 / ANIMEXTS1.0
+func stripGIFMetadata(data []byte) ([]byte, error) {
+	const headerLen = 13 // "GIF87a"/"GIF89a" + 逻辑屏幕描述符
+	if len(data) < headerLen || (string(data[:6]) != "GIF87a" && string(data[:6]) != "GIF89a") {
+		return nil, errMalformedImage
+	}
+
+	i := headerLen
+	if flags := data[10]; flags&0x80 != 0 { // 全局颜色表
+		i += 3 << (flags&0x07 + 1)
+	}
+	if i > len(data) {
+		return nil, errMalformedImage
+	}
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(data[:i])
+
+	for i < len(data) {
+		start := i
+		switch data[i] {
+		case 0x3B: // 结束符，之后的数据一并丢弃
+			out.WriteByte(0x3B)
+			return out.Bytes(), nil
+		case 0x21: // 扩展块：标签 + 子块序列
+			if i+2 > len(data) {
+				return nil, errMalformedImage
+			}
+			label := data[i+1]
+			end, ok := skipGIFSubBlocks(data, i+2)
+			if !ok {
+				return nil, errMalformedImage
+			}
+			keep := true
+			switch label {
+			case 0xFE: // 注释
+				keep = false
+			case 0xFF: // 应用扩展，第一个子块是 11 字节的应用标识
+				keep = i+14 <= end && data[i+2] == 11 &&
+					(string(data[i+3:i+14]) == "NETSCAPE2.0" || string(data[i+3:i+14]) == "ANIMEXTS1.0")
+			}
+			if keep {
+				out.Write(data[start:end])
+			}
+			i = end
+		case 0x2C: // 图像描述符 + 局部颜色表 + LZW 最小码长 + 图像数据子块
+			if i+10 > len(data) {
+				return nil, errMalformedImage
+			}
+			i += 10
+			if flags := data[i-1]; flags&0x80 != 0 {
+				i += 3 << (flags&0x07 + 1)
+			}
+			i++ // LZW 最小码长
+			end, ok := skipGIFSubBlocks(data, i)
+			if !ok {
+				return nil, errMalformedImage
+			}
+			out.Write(data[start:end])
+			i = end
+		default:
+			return nil, errMalformedImage
+		}
+	}
+	// 缺少结束符，文件被截断
+	return nil, errMalformedImage
+}
+
+// skipGIFSubBlocks 跳过从 i 开始的子块序列（以长度为 0 的块结束），返回序列之后的位置
+func skipGIFSubBlocks(data []byte, i int) (int, bool) {
+	for i < len(data) {
+		size := int(data[i])
+		i++
+		if size == 0 {
+			return i, true
+		}
+		i += size
+	}
+	return 0, false
+}
+
+// stripWebPMetadata 去掉 WebP（RIFF 容器）中的 EXIF 和 XMP 块，并清除 VP8X 头中对应的标志位
+func stripWebPMetadata(data []byte) ([]byte, error) {
+	const headerLen = 12 // "RIFF" + 大小 + "WEBP"
+	if len(data) < headerLen || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, errMalformedImage
+	}
+
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(data[:headerLen])
+	for i := headerLen; i < len(data); {
+		if i+8 > len(data) {
+			return nil, errMalformedImage
+		}
+		size := int(binary.LittleEndian.Uint32(data[i+4:]))
+		end := i + 8 + size + size&1 // 块数据按偶数字节对齐
+		if size < 0 || end > len(data) {
+			return nil, errMalformedImage
+		}
+		switch string(data[i : i+4]) {
+		case "EXIF", "XMP ": // 丢弃
+		case "VP8X":
+			chunk := append([]byte(nil), data[i:end]...)
+			if size > 0 {
+				chunk[8] &^= 0x08 | 0x04 // EXIF、XMP 标志位
+			}
+			out.Write(chunk)
+		default:
+			out.Write(data[i:end])
+		}
+		i = end
+	}
+
+	result := out.Bytes()
+	binary.LittleEndian.PutUint32(result[4:], uint32(len(result)-8))
+	return result, nil
+}
+
+// toRGBA 转成 RGBA 以便直接操作像素
+func toRGBA(img image.Image) *image.RGBA {
+	bounds := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, bounds.Min, draw.Src)
+	return rgba
+}
+
+// orientImage 按 EXIF Orientation（1-8）翻转或旋转图片
+func orientImage(src *image.RGBA, orientation int) *image.RGBA {
+	if orientation <= 1 || orientation > 8 {
+		return src
+	}
+
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	// 目标像素 (x, y) 对应的源像素
+	source := map[int]func(x, y int) (int, int){
+		2: func(x, y int) (int, int) { return w - 1 - x, y },
+		3: func(x, y int) (int, int) { return w - 1 - x, h - 1 - y },
+		4: func(x, y int) (int, int) { return x, h - 1 - y },
+		5: func(x, y int) (int, int) { return y, x },
+		6: func(x, y int) (int, int) { return y, h - 1 - x },
+		7: func(x, y int) (int, int) { return w - 1 - y, h - 1 - x },
+		8: func(x, y int) (int, int) { return w - 1 - y, x },
+	}[orientation]
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			sx, sy := source(x, y)
+			copy(dst.Pix[dst.PixOffset(x, y):dst.PixOffset(x, y)+4], src.Pix[src.PixOffset(sx, sy):src.PixOffset(sx, sy)+4])
+		}
+	}
+	return dst
+}
+
+// resizeImage 等比缩小到最长边不超过 maxEdge，用区域平均（box filter）采样；原图更小时不放大
+func resizeImage(src *image.RGBA, maxEdge int) *image.RGBA {
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	if w <= maxEdge && h <= maxEdge {
+		return src
+	}
+	dw, dh := maxEdge, h*maxEdge/w
+	if h > w {
+		dw, dh = w*maxEdge/h, maxEdge
+	}
+	dw, dh = max(dw, 1), max(dh, 1)
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		y0, y1 := y*h/dh, max((y+1)*h/dh, y*h/dh+1)
+		for x := 0; x < dw; x++ {
+			x0, x1 := x*w/dw, max((x+1)*w/dw, x*w/dw+1)
+
+			var sum [4]int
+			for sy := y0; sy < y1; sy++ {
+				offset := src.PixOffset(x0, sy)
+				for sx := x0; sx < x1; sx++ {
+					for c := 0; c < 4; c++ {
+						sum[c] += int(src.Pix[offset+c])
+					}
+					offset += 4
+				}
+			}
+			n := (y1 - y0) * (x1 - x0)
+			offset := dst.PixOffset(x, y)
+			for c := 0; c < 4; c++ {
+				dst.Pix[offset+c] = uint8(sum[c] / n)
+			}
+		}
+	}
+	return dst
+}
+
+// encodeThumbnail 有透明通道可能的格式输出 PNG，其余输出 JPEG
+func encodeThumbnail(img *image.RGBA, sourceMimeType string) ([]byte, string, error) {
+	var buf bytes.Buffer
+	if sourceMimeType == "image/png" || sourceMimeType == "image/gif" {
+		if err := png.Encode(&buf, img); err != nil {
+			return nil, "", err
+		}
+		return buf.Bytes(), "image/png", nil
+	}
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 80}); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), "image/jpeg", nil
+}
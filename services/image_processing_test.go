@@ -0,0 +1,368 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// secrets 测试图片元数据中写入的内容，处理后的文件里不能再出现
+var secrets = []string{"Exif", "GPS 31.2304N 121.4737E", "XMP", "secret comment", "Author"}
+
+func testImage(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x * 40), G: uint8(y * 40), B: 100, A: 255})
+		}
+	}
+	return img
+}
+
+// exifPayload APP1 / eXIf 的内容：方向标签和一段 GPS 文本
+func exifPayload(orientation uint16) []byte {
+	var tiff bytes.Buffer
+	tiff.WriteString("II*\x00")
+	binary.Write(&tiff, binary.LittleEndian, uint32(8)) // IFD0 偏移
+	binary.Write(&tiff, binary.LittleEndian, uint16(1)) // 条目数
+	binary.Write(&tiff, binary.LittleEndian, uint16(0x0112))
+	binary.Write(&tiff, binary.LittleEndian, uint16(3)) // SHORT
+	binary.Write(&tiff, binary.LittleEndian, uint32(1))
+	binary.Write(&tiff, binary.LittleEndian, uint32(orientation))
+	binary.Write(&tiff, binary.LittleEndian, uint32(0))
+	tiff.WriteString("GPS 31.2304N 121.4737E")
+	return append([]byte("Exif\x00\x00"), tiff.Bytes()...)
+}
+
+func jpegSegment(marker byte, payload []byte) []byte {
+	segment := []byte{0xFF, marker, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+	return append(segment, payload...)
+}
+
+// jpegWithMetadata 在 SOI 之后插入 EXIF、XMP、IPTC 和注释段
+func jpegWithMetadata(t *testing.T, w, h int, orientation uint16) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, testImage(w, h), nil); err != nil {
+		t.Fatal(err)
+	}
+	encoded := buf.Bytes()
+
+	var out bytes.Buffer
+	out.Write(encoded[:2])
+	out.Write(jpegSegment(0xE1, exifPayload(orientation)))
+	out.Write(jpegSegment(0xE1, []byte("http://ns.adobe.com/xap/1.0/\x00<x:xmpmeta>XMP</x:xmpmeta>")))
+	out.Write(jpegSegment(0xED, []byte("Photoshop 3.0\x00Author")))
+	out.Write(jpegSegment(0xFE, []byte("secret comment")))
+	out.Write(encoded[2:])
+	return out.Bytes()
+}
+
+func pngChunk(chunkType string, data []byte) []byte {
+	chunk := make([]byte, 8, 12+len(data))
+	binary.BigEndian.PutUint32(chunk, uint32(len(data)))
+	copy(chunk[4:], chunkType)
+	chunk = append(chunk, data...)
+	return binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+}
+
+// pngWithMetadata 在 IHDR 之后插入 eXIf 和各种文本块
+func pngWithMetadata(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, testImage(4, 3)); err != nil {
+		t.Fatal(err)
+	}
+	encoded := buf.Bytes()
+	ihdrEnd := 8 + 12 + 13
+
+	var out bytes.Buffer
+	out.Write(encoded[:ihdrEnd])
+	out.Write(pngChunk("eXIf", exifPayload(1)[6:]))
+	out.Write(pngChunk("tEXt", []byte("Author\x00someone")))
+	out.Write(pngChunk("zTXt", []byte("Comment\x00\x00secret comment")))
+	out.Write(pngChunk("iTXt", []byte("XML:com.adobe.xmp\x00\x00\x00\x00\x00<x:xmpmeta>XMP</x:xmpmeta>")))
+	out.Write(encoded[ihdrEnd:])
+	return out.Bytes()
+}
+
+// gifWithMetadata 在第一个块之前插入 XMP 应用扩展和注释扩展，编码器自己会写入 NETSCAPE2.0 循环扩展
+func gifWithMetadata(t *testing.T) []byte {
+	t.Helper()
+	palette := color.Palette{color.Black, color.White}
+	frames := []*image.Paletted{image.NewPaletted(image.Rect(0, 0, 4, 3), palette), image.NewPaletted(image.Rect(0, 0, 4, 3), palette)}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, &gif.GIF{Image: frames, Delay: []int{10, 10}, LoopCount: 0}); err != nil {
+		t.Fatal(err)
+	}
+	encoded := buf.Bytes()
+	offset := 13
+	if encoded[10]&0x80 != 0 {
+		offset += 3 << (encoded[10]&0x07 + 1)
+	}
+
+	xmp := []byte("<x:xmpmeta>XMP GPS 31.2304N 121.4737E</x:xmpmeta>")
+	var out bytes.Buffer
+	out.Write(encoded[:offset])
+	out.Write([]byte{0x21, 0xFF, 11})
+	out.WriteString("XMP DataXMP")
+	out.WriteByte(byte(len(xmp)))
+	out.Write(xmp)
+	out.WriteByte(0)
+	out.Write([]byte{0x21, 0xFE, byte(len("secret comment"))})
+	out.WriteString("secret comment")
+	out.WriteByte(0)
+	out.Write(encoded[offset:])
+	return out.Bytes()
+}
+
+func riffChunk(fourCC string, data []byte) []byte {
+	chunk := []byte(fourCC)
+	chunk = binary.LittleEndian.AppendUint32(chunk, uint32(len(data)))
+	chunk = append(chunk, data...)
+	if len(data)%2 == 1 {
+		chunk = append(chunk, 0)
+	}
+	return chunk
+}
+
+// webpWithMetadata 带 EXIF 和 XMP 块的扩展格式 WebP，图像数据用占位内容
+func webpWithMetadata() []byte {
+	vp8x := make([]byte, 10)
+	vp8x[0] = 0x08 | 0x04
+	var body bytes.Buffer
+	body.WriteString("WEBP")
+	body.Write(riffChunk("VP8X", vp8x))
+	body.Write(riffChunk("VP8L", []byte{0x2F, 1, 2, 3, 4}))
+	body.Write(riffChunk("EXIF", exifPayload(1)[6:]))
+	body.Write(riffChunk("XMP ", []byte("<x:xmpmeta>XMP</x:xmpmeta>")))
+
+	out := []byte("RIFF")
+	out = binary.LittleEndian.AppendUint32(out, uint32(body.Len()))
+	return append(out, body.Bytes()...)
+}
+
+func assertNoMetadata(t *testing.T, data []byte) {
+	t.Helper()
+	for _, secret := range secrets {
+		if bytes.Contains(data, []byte(secret)) {
+			t.Errorf("metadata %q survived", secret)
+		}
+	}
+}
+
+func TestStripMetadata(t *testing.T) {
+	jpegData := jpegWithMetadata(t, 4, 3, 1)
+	pngData := pngWithMetadata(t)
+	gifData := gifWithMetadata(t)
+	webpData := webpWithMetadata()
+
+	strip := map[string]func([]byte) ([]byte, error){
+		"jpeg": func(data []byte) ([]byte, error) {
+			out, _, err := stripJPEGMetadata(data)
+			return out, err
+		},
+		"png":  stripPNGMetadata,
+		"gif":  stripGIFMetadata,
+		"webp": stripWebPMetadata,
+	}
+	tests := []struct {
+		name    string
+		format  string
+		data    []byte
+		wantErr bool
+	}{
+		{"jpeg", "jpeg", jpegData, false},
+		{"jpeg truncated in exif", "jpeg", jpegData[:30], true},
+		{"jpeg truncated in tables", "jpeg", jpegData[:200], true},
+		{"jpeg truncated in scan data", "jpeg", jpegData[:len(jpegData)-5], false}, // 元数据已在扫描数据之前去掉
+		{"jpeg missing soi", "jpeg", jpegData[2:], true},
+		{"jpeg empty", "jpeg", nil, true},
+		{"png", "png", pngData, false},
+		{"png truncated in text chunk", "png", pngData[:60], true},
+		{"png missing iend", "png", pngData[:len(pngData)-12], true},
+		{"png bad signature", "png", pngData[1:], true},
+		{"gif", "gif", gifData, false},
+		{"gif truncated in xmp", "gif", gifData[:40], true},
+		{"gif missing trailer", "gif", gifData[:len(gifData)-1], true},
+		{"gif bad header", "gif", append([]byte("GIF00a"), gifData[6:]...), true},
+		{"webp", "webp", webpData, false},
+		{"webp truncated in exif", "webp", webpData[:50], true},
+		{"webp bad header", "webp", webpData[4:], true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := strip[tt.format](tt.data)
+			if tt.wantErr {
+				if !errors.Is(err, errMalformedImage) {
+					t.Fatalf("got %v, want errMalformedImage", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertNoMetadata(t, out)
+		})
+	}
+}
+
+func TestStrippedImagesStillDecode(t *testing.T) {
+	jpegData, _, err := stripJPEGMetadata(jpegWithMetadata(t, 4, 3, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pngData, err := stripPNGMetadata(pngWithMetadata(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gifData, err := stripGIFMetadata(gifWithMetadata(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, data := range map[string][]byte{"jpeg": jpegData, "png": pngData, "gif": gifData} {
+		if _, _, err := image.Decode(bytes.NewReader(data)); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+	// 循环播放设置保留
+	decoded, err := gif.DecodeAll(bytes.NewReader(gifData))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded.Image) != 2 || decoded.LoopCount != 0 {
+		t.Errorf("gif: %d frames, loop count %d", len(decoded.Image), decoded.LoopCount)
+	}
+
+	webpData, err := stripWebPMetadata(webpWithMetadata())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := binary.LittleEndian.Uint32(webpData[4:]); int(size) != len(webpData)-8 {
+		t.Errorf("webp: RIFF size %d, file size %d", size, len(webpData))
+	}
+	if flags := webpData[20]; flags&(0x08|0x04) != 0 {
+		t.Errorf("webp: VP8X flags %#x still mark metadata", flags)
+	}
+}
+
+func TestStripJPEGOrientation(t *testing.T) {
+	_, orientation, err := stripJPEGMetadata(jpegWithMetadata(t, 4, 3, 6))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if orientation != 6 {
+		t.Errorf("got orientation %d, want 6", orientation)
+	}
+}
+
+func TestProcessImage(t *testing.T) {
+	// 方向 6 的图片摆正后宽高互换，重新编码的文件里也不含元数据
+	result, err := processImage(jpegWithMetadata(t, 4, 3, 6), "image/jpeg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Width != 3 || result.Height != 4 || result.Image == nil {
+		t.Errorf("got %dx%d, image %v", result.Width, result.Height, result.Image != nil)
+	}
+	assertNoMetadata(t, result.Data)
+
+	for _, mimeType := range []string{"image/jpeg", "image/png", "image/gif"} {
+		if _, err := processImage([]byte("not an image"), mimeType); !errors.Is(err, errMalformedImage) {
+			t.Errorf("%s: got %v, want errMalformedImage", mimeType, err)
+		}
+	}
+}
+
+// pixels 取出每个像素的 R 通道，按行排列
+func pixels(img *image.RGBA) [][]uint8 {
+	rows := make([][]uint8, img.Bounds().Dy())
+	for y := range rows {
+		rows[y] = make([]uint8, img.Bounds().Dx())
+		for x := range rows[y] {
+			rows[y][x] = img.Pix[img.PixOffset(x, y)]
+		}
+	}
+	return rows
+}
+
+func fromPixels(rows [][]uint8) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, len(rows[0]), len(rows)))
+	for y, row := range rows {
+		for x, v := range row {
+			img.Set(x, y, color.RGBA{R: v, A: 255})
+		}
+	}
+	return img
+}
+
+func TestOrientImage(t *testing.T) {
+	// a b c
+	// d e f
+	const a, b, c, d, e, f = 1, 2, 3, 4, 5, 6
+	src := [][]uint8{{a, b, c}, {d, e, f}}
+
+	tests := []struct {
+		orientation int
+		want        [][]uint8
+	}{
+		{0, src},
+		{1, src},
+		{2, [][]uint8{{c, b, a}, {f, e, d}}},   // 水平翻转
+		{3, [][]uint8{{f, e, d}, {c, b, a}}},   // 旋转 180°
+		{4, [][]uint8{{d, e, f}, {a, b, c}}},   // 垂直翻转
+		{5, [][]uint8{{a, d}, {b, e}, {c, f}}}, // 转置
+		{6, [][]uint8{{d, a}, {e, b}, {f, c}}}, // 顺时针 90°
+		{7, [][]uint8{{f, c}, {e, b}, {d, a}}}, // 反转置
+		{8, [][]uint8{{c, f}, {b, e}, {a, d}}}, // 逆时针 90°
+		{9, src},
+	}
+	for _, tt := range tests {
+		got := pixels(orientImage(fromPixels(src), tt.orientation))
+		if !equalPixels(got, tt.want) {
+			t.Errorf("orientation %d: got %v, want %v", tt.orientation, got, tt.want)
+		}
+	}
+}
+
+func TestResizeImage(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     [][]uint8
+		maxEdge int
+		want    [][]uint8
+	}{
+		{"landscape averages 2x2 blocks", [][]uint8{{0, 100, 200, 40}, {20, 60, 80, 120}}, 2, [][]uint8{{45, 110}}},
+		{"portrait", [][]uint8{{10, 30}, {50, 70}, {0, 0}, {4, 8}}, 2, [][]uint8{{40}, {3}}},
+		{"smaller than max is unchanged", [][]uint8{{1, 2}, {3, 4}}, 10, [][]uint8{{1, 2}, {3, 4}}},
+		{"thin image keeps at least one pixel", [][]uint8{{10, 20, 30, 40}}, 2, [][]uint8{{15, 35}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pixels(resizeImage(fromPixels(tt.src), tt.maxEdge)); !equalPixels(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func equalPixels(a, b [][]uint8) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !bytes.Equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,255 @@
+package services
+
+import (
+	"chat-system/config"
+	"chat-system/models"
+	"chat-system/utils"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// mentionAll @all 提及全体成员
+const mentionAll = "all"
+
+// mentionPattern @ 前必须是文本开头或非 ASCII 单词字符，避免把 bob@example.com 当作提及，
+// 同时允许中文紧跟 @，如 "你好@张三"；@ 前是 / 的视为链接路径，如 https://medium.com/@alice
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w/])@([\p{L}\p{N}_.\-]+)`)
+
+// ParseMentions 从消息内容中解析出被 @ 的用户名（去重，保持出现顺序）
+func ParseMentions(content string) []string {
+	seen := make(map[string]bool)
+	usernames := make([]string, 0)
+	for _, match := range mentionPattern.FindAllStringSubmatch(content, -1) {
+		// 句末的标点不属于用户名，如 "@alice." "@alice-"
+		username := strings.TrimRight(match[1], ".-")
+		if username == "" {
+			continue
+		}
+		if strings.EqualFold(username, mentionAll) {
+			username = mentionAll
+		}
+		if !seen[username] {
+			seen[username] = true
+			usernames = append(usernames, username)
+		}
+	}
+	return usernames
+}
+
+// recordMentions 解析群消息中的 @username / @all，写入提及记录并通知被提及的成员
+func recordMentions(message *models.Message, memberIDs []string) {
+	targets, mentionedAll := mentionTargets(message, memberIDs)
+	if len(targets) == 0 {
+		return
+	}
+
+	userIDs := make([]string, 0, len(targets))
+	for userID := range targets {
+		userIDs = append(userIDs, userID)
+	}
+	saveMentions(message, userIDs, mentionedAll)
+}
+
+// updateMentions 编辑后重新解析提及：删除不再提及的记录，只为新增的成员写入记录并通知
+func updateMentions(message *models.Message) {
+	conversation, err := GetConversationByID(message.ConversationID)
+	if err != nil || conversation.GroupID == "" {
+		return
+	}
+	memberIDs, err := GetConversationMemberIDs(conversation)
+	if err != nil {
+		log.Println("Failed to resolve mention targets:", err)
+		return
+	}
+	targets, mentionedAll := mentionTargets(message, memberIDs)
+
+	var existing []models.MessageMention
+	if err := config.DB.Where("message_id = ?", message.ID).Find(&existing).Error; err != nil {
+		log.Println("Failed to load mentions:", err)
+		return
+	}
+	removed := make([]uint, 0)
+	for _, mention := range existing {
+		if targets[mention.UserID] {
+			delete(targets, mention.UserID)
+		} else {
+			removed = append(removed, mention.ID)
+		}
+	}
+	if len(removed) > 0 {
+		if err := config.DB.Where("id IN ?", removed).Delete(&models.MessageMention{}).Error; err != nil {
+			log.Println("Failed to remove mentions:", err)
+		}
+	}
+	if err := config.DB.Model(&models.MessageMention{}).
+		Where("message_id = ? AND is_all <> ?", message.ID, mentionedAll).
+		Update("is_all", mentionedAll).Error; err != nil {
+		log.Println("Failed to update mentions:", err)
+	}
+
+	added := make([]string, 0, len(targets))
+	for userID := range targets {
+		added = append(added, userID)
+	}
+	if len(added) > 0 {
+		saveMentions(message, added, mentionedAll)
+	}
+}
+
+// mentionTargets 返回消息中被提及的群成员（不含发送者），以及是否使用了 @all
+func mentionTargets(message *models.Message, memberIDs []string) (map[string]bool, bool) {
+	usernames := ParseMentions(message.Content)
+	if len(usernames) == 0 {
+		return nil, false
+	}
+
+	mentionedAll := false
+	names := make([]string, 0, len(usernames))
+	for _, username := range usernames {
+		if username == mentionAll {
+			mentionedAll = true
+			continue
+		}
+		names = append(names, username)
+	}
+
+	// 只有群成员才能被提及，且不提及发送者自己
+	targets := make(map[string]bool)
+	if mentionedAll {
+		for _, memberID := range memberIDs {
+			targets[memberID] = true
+		}
+	} else if len(names) > 0 {
+		var users []models.User
+		config.DB.Select("id").Where("username IN ?", names).Find(&users)
+		for _, user := range users {
+			if userID := fmt.Sprint(user.ID); containsID(memberIDs, userID) {
+				targets[userID] = true
+			}
+		}
+	}
+	delete(targets, message.SenderID)
+	return targets, mentionedAll
+}
+
+// saveMentions 写入提及记录并通知被提及的成员
+func saveMentions(message *models.Message, userIDs []string, mentionedAll bool) {
+	mentions := make([]models.MessageMention, 0, len(userIDs))
+	for _, userID := range userIDs {
+		mentions = append(mentions, models.MessageMention{
+			MessageID:      message.ID,
+			ConversationID: message.ConversationID,
+			UserID:         userID,
+			SenderID:       message.SenderID,
+			IsAll:          mentionedAll,
+		})
+	}
+	if err := config.DB.Create(&mentions).Error; err != nil {
+		log.Println("Failed to save mentions:", err)
+		return
+	}
+
+	Manager.SendEvent(userIDs, EventMention, MentionEvent{
+		MessageID:      message.ID,
+		ConversationID: message.ConversationID,
+		SenderID:       message.SenderID,
+		IsAll:          mentionedAll,
+	})
+}
+
+// MentionView 提及我的消息
+type MentionView struct {
+	MentionID      uint        `json:"mention_id"`
+	ConversationID string      `json:"conversation_id"`
+	IsAll          bool        `json:"is_all"`
+	CreatedAt      time.Time   `json:"created_at"`
+	Message        MessageView `json:"message"`
+}
+
+// MentionPage 一页提及记录，按时间倒序
+type MentionPage struct {
+	Mentions   []MentionView `json:"mentions"`
+	NextCursor uint          `json:"next_cursor"` // 下一页传入 before
+	HasMore    bool          `json:"has_more"`
+}
+
+// GetMentionsOfUser 按游标分页返回提及该用户的消息，跳过“仅对我删除”的消息
+func GetMentionsOfUser(userID string, page utils.CursorPagination) (*MentionPage, error) {
+	query := config.DB.Where("user_id = ? AND message_id NOT IN (?)", userID, hiddenMessageIDsQuery(userID))
+	if page.Before > 0 {
+		query = query.Where("id < ?", page.Before)
+	}
+
+	var mentions []models.MessageMention
+	if err := query.Order("id DESC").Limit(page.Limit + 1).Find(&mentions).Error; err != nil {
+		return nil, fmt.Errorf("failed to load mentions: %w", err)
+	}
+
+	result := &MentionPage{HasMore: len(mentions) > page.Limit}
+	if result.HasMore {
+		mentions = mentions[:page.Limit]
+	}
+
+	messageIDs := make([]uint, 0, len(mentions))
+	for _, mention := range mentions {
+		messageIDs = append(messageIDs, mention.MessageID)
+	}
+	var messages []models.Message
+	if len(messageIDs) > 0 {
+		config.DB.Where("id IN ?", messageIDs).Find(&messages)
+	}
+	viewsByID := make(map[uint]MessageView, len(messages))
+	for _, view := range BuildMessageViews(messages) {
+		viewsByID[view.ID] = view
+	}
+
+	result.Mentions = make([]MentionView, 0, len(mentions))
+	for _, mention := range mentions {
+		view, ok := viewsByID[mention.MessageID]
+		if !ok {
+			continue
+		}
+		result.Mentions = append(result.Mentions, MentionView{
+			MentionID:      mention.ID,
+			ConversationID: mention.ConversationID,
+			IsAll:          mention.IsAll,
+			CreatedAt:      mention.CreatedAt,
+			Message:        view,
+		})
+	}
+	if len(mentions) > 0 {
+		result.NextCursor = mentions[len(mentions)-1].ID
+	}
+	return result, nil
+}
+
+// GetUnreadMentionCounts 统计用户在各会话中已读游标之后的提及数
+func GetUnreadMentionCounts(userID string, conversationIDs []string) (map[string]int64, error) {
+	counts := make(map[string]int64, len(conversationIDs))
+	if len(conversationIDs) == 0 {
+		return counts, nil
+	}
+
+	var rows []struct {
+		ConversationID string
+		Count          int64
+	}
+	err := config.DB.Table("message_mentions").
+		Select("message_mentions.conversation_id, COUNT(*) AS count").
+		Joins("LEFT JOIN conversation_participants cp ON cp.conversation_id = message_mentions.conversation_id AND cp.user_id = message_mentions.user_id").
+		Where("message_mentions.user_id = ? AND message_mentions.conversation_id IN ?", userID, conversationIDs).
+		Where("message_mentions.message_id > COALESCE(cp.last_read_message_id, 0)").
+		Group("message_mentions.conversation_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to count unread mentions: %w", err)
+	}
+
+	for _, row := range rows {
+		counts[row.ConversationID] = row.Count
+	}
+	return counts, nil
+}
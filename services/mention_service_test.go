@@ -0,0 +1,47 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseMentions(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{"start of text", "@alice hello", []string{"alice"}},
+		{"end of text", "hello @alice", []string{"alice"}},
+		{"only mention", "@alice", []string{"alice"}},
+		{"bare at", "hello @", []string{}},
+		{"at at end", "mail me @", []string{}},
+		{"email", "mail bob@example.com please", []string{}},
+		{"email with plus", "bob+chat@example.com", []string{}},
+		{"email and mention", "@alice mail bob@example.com", []string{"alice"}},
+		{"url path", "see https://medium.com/@alice/post", []string{}},
+		{"url user info", "ftp://user@host.example.com", []string{}},
+		{"cjk name", "@张三 你好", []string{"张三"}},
+		{"cjk before at", "你好@张三", []string{"张三"}},
+		{"cjk fullwidth punctuation", "@张三，@李四。", []string{"张三", "李四"}},
+		{"trailing period", "thanks @alice.", []string{"alice"}},
+		{"trailing ellipsis", "@alice...", []string{"alice"}},
+		{"trailing comma and colon", "@alice, @bob: hi", []string{"alice", "bob"}},
+		{"trailing question", "@alice?", []string{"alice"}},
+		{"trailing dash", "@alice- hi", []string{"alice"}},
+		{"dotted name", "@alice.smith hi", []string{"alice.smith"}},
+		{"in parentheses", "(@alice)", []string{"alice"}},
+		{"only punctuation", "@. @-", []string{}},
+		{"duplicates", "@alice @bob @alice", []string{"alice", "bob"}},
+		{"all case insensitive", "@ALL @all @All", []string{"all"}},
+		{"adjacent mentions", "@alice@bob", []string{"alice"}},
+		{"multiline", "@alice\n@bob", []string{"alice", "bob"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseMentions(tt.content); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseMentions(%q) = %q, want %q", tt.content, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,336 @@
+package services
+
+import (
+	"chat-system/config"
+	"chat-system/models"
+	"chat-system/utils"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// SendMessageInput 发送消息的参数，WebSocket 和 REST 共用
+type SendMessageInput struct {
+	ConversationID string
+	Content        string
+	MessageType    string
+	ClientMsgID    string         // 可选，客户端生成的幂等 ID
+	ReplyToID      uint           // 可选，引用回复的消息 ID，必须属于同一会话
+	ForwardedFrom  *ForwardSource // 转发时的来源信息
+	AttachmentIDs  []string       // 可选，发送者上传且尚未使用的附件
+	// 发出消息的 WebSocket 连接，消息会同步到发送者的其他设备；REST 发送时为空，同步到全部连接
+	OriginConnectionID string
+
+	forwardedAttachments []models.Attachment // 转发时沿用原消息的附件
+}
+
+var (
+	ErrNotConversationMember = errors.New("you are not part of this conversation")
+	ErrInvalidReplyTarget    = errors.New("reply target must be a message in the same conversation")
+)
+
+// SendChatMessage 校验权限、存储消息并推送给会话内其他成员。
+// 同一发送者重复提交相同 client_msg_id 时返回已存在的消息，duplicate 为 true 且不再重复推送。
+func SendChatMessage(senderID string, input SendMessageInput) (*models.Message, bool, error) {
+	// 重试时附件已被第一次提交占用，先按幂等键查找，避免误报附件不可用
+	if input.ClientMsgID != "" {
+		if existing, ok := findByDedupKey(messageDedupKey(senderID, input.ClientMsgID)); ok {
+			return existing, true, nil
+		}
+	}
+
+	conversation, err := GetConversationByID(input.ConversationID)
+	if err != nil {
+		return nil, false, err
+	}
+	message, attachments, err := prepareMessage(senderID, conversation, input)
+	if err != nil {
+		return nil, false, err
+	}
+
+	duplicate, err := PersistMessage(message, attachments)
+	if err != nil {
+		return nil, false, err
+	}
+	if duplicate {
+		return message, true, nil
+	}
+
+	deliverMessage(conversation, message, input.OriginConnectionID)
+	return message, false, nil
+}
+
+// prepareMessage 校验发送权限、附件和回复目标，构造待存储的消息
+func prepareMessage(senderID string, conversation *models.Conversation, input SendMessageInput) (*models.Message, []models.Attachment, error) {
+	attachments := input.forwardedAttachments
+	if len(input.AttachmentIDs) > 0 {
+		var err error
+		if attachments, err = loadUnlinkedAttachments(senderID, input.AttachmentIDs); err != nil {
+			return nil, nil, err
+		}
+	}
+	if strings.TrimSpace(input.Content) == "" && len(attachments) == 0 {
+		return nil, nil, ErrEmptyMessageContent
+	}
+
+	message := &models.Message{
+		ConversationID: conversation.ConversationID,
+		SenderID:       senderID,
+		Type:           conversation.Type,
+		Content:        input.Content,
+		MessageType:    input.MessageType,
+		ClientMsgID:    input.ClientMsgID,
+	}
+	if conversation.GroupID != "" {
+		if _, err := CheckGroupPermission(conversation.GroupID, senderID, PermSendMessage); err != nil {
+			return nil, nil, err
+		}
+		message.GroupID = conversation.GroupID
+	} else {
+		if conversation.ParticipantA != senderID && conversation.ParticipantB != senderID {
+			return nil, nil, ErrNotConversationMember
+		}
+		message.ReceiverID = conversation.ParticipantA
+		if message.ReceiverID == senderID {
+			message.ReceiverID = conversation.ParticipantB
+		}
+	}
+
+	if input.ForwardedFrom != nil {
+		message.ForwardedFromMessageID = &input.ForwardedFrom.MessageID
+		message.ForwardedFromSenderID = input.ForwardedFrom.SenderID
+		message.ForwardedFromConversationID = input.ForwardedFrom.ConversationID
+	}
+	if input.ReplyToID > 0 {
+		parent, err := GetMessageByID(input.ReplyToID)
+		if err != nil || parent.ConversationID != conversation.ConversationID {
+			return nil, nil, ErrInvalidReplyTarget
+		}
+		// 回复的回复仍归属同一个话题根消息
+		rootID := parent.ID
+		if parent.ThreadRootID != nil {
+			rootID = *parent.ThreadRootID
+		}
+		message.ReplyToID = &parent.ID
+		message.ThreadRootID = &rootID
+	}
+	return message, attachments, nil
+}
+
+// deliverMessage 推送已存储的消息：在线的其他成员、发送者的其他设备，并记录 @ 提及
+func deliverMessage(conversation *models.Conversation, message *models.Message, originConnectionID string) {
+	// 推送给在线的其他成员，离线成员上线后通过 sync 补发
+	memberIDs, err := GetConversationMemberIDs(conversation)
+	if err != nil {
+		log.Println("Failed to resolve message recipients:", err)
+		return
+	}
+	Manager.SendMessageToUsers(conversation.ConversationID, excludeUser(memberIDs, message.SenderID), *message)
+	Manager.SendMessageToOtherDevices(message.SenderID, originConnectionID, *message)
+	// 消息发出即视为停止输入
+	Typing.Stop(conversation.ConversationID, message.SenderID)
+	if conversation.GroupID != "" {
+		recordMentions(message, memberIDs)
+	}
+}
+
+// PersistMessage 存储新消息：消息直接以 sent 状态落库，与会话排序的更新、附件的关联在同一事务中完成。
+// 带 client_msg_id 且已存在相同记录时，message 会被替换为已有消息并返回 true。
+func PersistMessage(message *models.Message, attachments []models.Attachment) (bool, error) {
+	if message.ClientMsgID != "" {
+		dedupKey := messageDedupKey(message.SenderID, message.ClientMsgID)
+		message.DedupKey = &dedupKey
+		if existing, ok := findByDedupKey(dedupKey); ok {
+			*message = *existing
+			return true, nil
+		}
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		return createMessage(tx, message, attachments)
+	})
+	if err != nil {
+		// 并发重试时唯一索引冲突，以先落库的那条为准
+		if message.DedupKey != nil {
+			if existing, ok := findByDedupKey(*message.DedupKey); ok {
+				*message = *existing
+				return true, nil
+			}
+		}
+		message.ID = 0
+		message.Status = models.MessageStatusFailed
+		if errors.Is(err, ErrAttachmentUnavailable) {
+			return false, err
+		}
+		return false, fmt.Errorf("failed to save message: %w", err)
+	}
+
+	indexMessage(message)
+	return false, nil
+}
+
+// createMessage 在事务中以 sent 状态写入消息、更新会话排序并关联附件
+func createMessage(tx *gorm.DB, message *models.Message, attachments []models.Attachment) error {
+	message.Status = models.MessageStatusSent
+	if err := tx.Create(message).Error; err != nil {
+		return err
+	}
+	// 更新会话列表排序
+	if err := tx.Model(&models.Conversation{}).
+		Where("conversation_id = ?", message.ConversationID).
+		Update("last_message_at", message.CreatedAt).Error; err != nil {
+		return err
+	}
+	return linkAttachments(tx, message.ID, attachments)
+}
+
+// messageDedupKey 同一发送者的 client_msg_id 唯一
+func messageDedupKey(senderID, clientMsgID string) string {
+	return senderID + ":" + clientMsgID
+}
+
+// findByDedupKey 根据幂等键查询已存在的消息
+func findByDedupKey(dedupKey string) (*models.Message, bool) {
+	var existing models.Message
+	if err := config.DB.Where("dedup_key = ?", dedupKey).First(&existing).Error; err != nil {
+		return nil, false
+	}
+	return &existing, true
+}
+
+// MessagePage 一页消息，按 ID 升序排列
+type MessagePage struct {
+	Messages   []MessageView `json:"messages"`
+	NextCursor uint          `json:"next_cursor"` // 向前翻页时为本页最小 ID，向后翻页时为本页最大 ID
+	HasMore    bool          `json:"has_more"`
+}
+
+// GetConversationMessages 按游标分页查询会话消息，跳过 viewer “仅对我删除”的消息。
+// 指定 after 时向后取更新的消息，否则从 before（缺省为最新）向前取更早的消息。
+func GetConversationMessages(conversationID, viewerID string, page utils.CursorPagination) (*MessagePage, error) {
+	query := config.DB.Where("conversation_id = ? AND id NOT IN (?)", conversationID, hiddenMessageIDsQuery(viewerID))
+	return queryMessagePage(query, page, page.After > 0)
+}
+
+// queryMessagePage 执行 keyset 分页：ascending 时取 after 之后的消息，否则取 before 之前的消息。
+// 结果统一按 ID 升序返回。
+func queryMessagePage(query *gorm.DB, page utils.CursorPagination, ascending bool) (*MessagePage, error) {
+	if ascending {
+		query = query.Where("id > ?", page.After).Order("id ASC")
+	} else {
+		if page.Before > 0 {
+			query = query.Where("id < ?", page.Before)
+		}
+		query = query.Order("id DESC")
+	}
+
+	// 多取一条用于判断是否还有下一页
+	var messages []models.Message
+	if err := query.Limit(page.Limit + 1).Find(&messages).Error; err != nil {
+		return nil, fmt.Errorf("failed to load messages: %w", err)
+	}
+
+	result := &MessagePage{HasMore: len(messages) > page.Limit}
+	if result.HasMore {
+		messages = messages[:page.Limit]
+	}
+	if !ascending {
+		// 倒序取出的结果翻转为升序
+		for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+			messages[i], messages[j] = messages[j], messages[i]
+		}
+	}
+
+	result.Messages = BuildMessageViews(messages)
+	result.NextCursor = page.After // 没有新消息时游标保持不变
+	if len(messages) > 0 {
+		if ascending {
+			result.NextCursor = messages[len(messages)-1].ID
+		} else {
+			result.NextCursor = messages[0].ID
+		}
+	}
+	return result, nil
+}
+
+// GetMissedMessages 按消息 ID 升序返回用户所有会话中 afterID 之后的消息，用于断线重连同步
+func GetMissedMessages(userID string, afterID uint, limit int) ([]models.Message, error) {
+	var messages []models.Message
+	err := config.DB.
+		Where("id > ? AND conversation_id IN (?)", afterID, UserConversationIDsQuery(userID)).
+		Where("id NOT IN (?)", hiddenMessageIDsQuery(userID)).
+		Order("id ASC").
+		Limit(limit).
+		Find(&messages).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to load missed messages: %w", err)
+	}
+	return messages, nil
+}
+
+// AdvanceMessageStatus 按状态机把消息推进到 to，返回实际发生变化的消息
+func AdvanceMessageStatus(messageIDs []uint, to string) ([]models.Message, error) {
+	if len(messageIDs) == 0 {
+		return nil, nil
+	}
+	from := models.MessageStatusPredecessors(to)
+
+	var messages []models.Message
+	if err := config.DB.Where("id IN ? AND status IN ?", messageIDs, from).Find(&messages).Error; err != nil {
+		return nil, fmt.Errorf("failed to load messages: %w", err)
+	}
+	if len(messages) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]uint, 0, len(messages))
+	for _, message := range messages {
+		ids = append(ids, message.ID)
+	}
+	if err := config.DB.Model(&models.Message{}).
+		Where("id IN ? AND status IN ?", ids, from).
+		Update("status", to).Error; err != nil {
+		return nil, fmt.Errorf("failed to update message status: %w", err)
+	}
+
+	for i := range messages {
+		messages[i].Status = to
+	}
+	notifyStatusChange(messages, to)
+	return messages, nil
+}
+
+// AcknowledgeDelivery 接收方确认收到消息，只处理发给该用户的私聊消息。
+// 群消息没有 receiver_id，且只有一个全局状态，任一成员确认都不代表全员送达，和已读一样不做流转，保持 sent
+func AcknowledgeDelivery(userID string, messageIDs []uint) error {
+	var acked []uint
+	if err := config.DB.Model(&models.Message{}).
+		Where("id IN ? AND receiver_id = ?", messageIDs, userID).
+		Pluck("id", &acked).Error; err != nil {
+		return fmt.Errorf("failed to load messages: %w", err)
+	}
+
+	_, err := AdvanceMessageStatus(acked, models.MessageStatusDelivered)
+	return err
+}
+
+// notifyStatusChange 按发送者和会话分组，把状态变化推送给发送者
+func notifyStatusChange(messages []models.Message, status string) {
+	type key struct{ senderID, conversationID string }
+	grouped := make(map[key][]uint)
+	for _, message := range messages {
+		k := key{message.SenderID, message.ConversationID}
+		grouped[k] = append(grouped[k], message.ID)
+	}
+
+	for k, ids := range grouped {
+		Manager.SendEvent([]string{k.senderID}, EventStatus, StatusEvent{
+			ConversationID: k.conversationID,
+			MessageIDs:     ids,
+			Status:         status,
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package services
+
+import (
+	"chat-system/config"
+	"chat-system/models"
+	"log"
+	"time"
+)
+
+// MessageView 返回给客户端的消息，在 models.Message 基础上附带聚合信息
+type MessageView struct {
+	models.Message
+	Reactions   []ReactionSummary `json:"reactions"`
+	ReplyTo     *MessageQuote     `json:"reply_to,omitempty"`      // 被引用消息的摘要
+	ReplyCount  int               `json:"reply_count"`             // 作为话题根消息时的回复数
+	LastReplyAt *time.Time        `json:"last_reply_at,omitempty"` // 作为话题根消息时最新回复的时间
+	Attachments []AttachmentView  `json:"attachments,omitempty"`
+}
+
+// MessageQuote 引用回复时展示的原消息摘要
+type MessageQuote struct {
+	ID          uint   `json:"id"`
+	SenderID    string `json:"sender_id"`
+	Content     string `json:"content"`
+	MessageType string `json:"message_type"`
+	Recalled    bool   `json:"recalled"`
+}
+
+type threadStats struct {
+	ThreadRootID uint
+	ReplyCount   int
+	LastReplyAt  time.Time
+}
+
+// BuildMessageViews 批量组装消息视图
+func BuildMessageViews(messages []models.Message) []MessageView {
+	messageIDs := make([]uint, 0, len(messages))
+	replyToIDs := make([]uint, 0)
+	for _, message := range messages {
+		messageIDs = append(messageIDs, message.ID)
+		if message.ReplyToID != nil {
+			replyToIDs = append(replyToIDs, *message.ReplyToID)
+		}
+	}
+
+	reactions, err := GetReactionSummaries(messageIDs)
+	if err != nil {
+		log.Println("Failed to load reactions:", err)
+	}
+	quotes := loadMessageQuotes(replyToIDs)
+	threads := loadThreadStats(messageIDs)
+	attachments := loadAttachmentsByMessage(messageIDs)
+	thumbnails := loadThumbnailsForMessages(attachments)
+
+	views := make([]MessageView, 0, len(messages))
+	for _, message := range messages {
+		view := MessageView{Message: message, Reactions: reactions[message.ID]}
+		if view.Reactions == nil {
+			view.Reactions = []ReactionSummary{}
+		}
+		if message.ReplyToID != nil {
+			view.ReplyTo = quotes[*message.ReplyToID]
+		}
+		if stats, ok := threads[message.ID]; ok {
+			lastReplyAt := stats.LastReplyAt
+			view.ReplyCount = stats.ReplyCount
+			view.LastReplyAt = &lastReplyAt
+		}
+		for _, attachment := range attachments[message.ID] {
+			view.Attachments = append(view.Attachments, newAttachmentView(attachment, thumbnails[attachment.ID]))
+		}
+		views = append(views, view)
+	}
+	return views
+}
+
+// loadMessageQuotes 批量查询被引用消息的摘要
+func loadMessageQuotes(messageIDs []uint) map[uint]*MessageQuote {
+	quotes := make(map[uint]*MessageQuote, len(messageIDs))
+	if len(messageIDs) == 0 {
+		return quotes
+	}
+
+	var parents []models.Message
+	if err := config.DB.Where("id IN ?", messageIDs).Find(&parents).Error; err != nil {
+		log.Println("Failed to load quoted messages:", err)
+		return quotes
+	}
+	for _, parent := range parents {
+		quotes[parent.ID] = &MessageQuote{
+			ID:          parent.ID,
+			SenderID:    parent.SenderID,
+			Content:     parent.Content,
+			MessageType: parent.MessageType,
+			Recalled:    parent.Recalled,
+		}
+	}
+	return quotes
+}
+
+// loadThreadStats 批量统计话题根消息的回复数和最新回复时间
+func loadThreadStats(messageIDs []uint) map[uint]threadStats {
+	stats := make(map[uint]threadStats, len(messageIDs))
+	if len(messageIDs) == 0 {
+		return stats
+	}
+
+	var rows []threadStats
+	err := config.DB.Model(&models.Message{}).
+		Select("thread_root_id, COUNT(*) AS reply_count, MAX(created_at) AS last_reply_at").
+		Where("thread_root_id IN ?", messageIDs).
+		Group("thread_root_id").
+		Scan(&rows).Error
+	if err != nil {
+		log.Println("Failed to load thread stats:", err)
+		return stats
+	}
+	for _, row := range rows {
+		stats[row.ThreadRootID] = row
+	}
+	return stats
+}
@@ -0,0 +1,162 @@
+package services
+
+import (
+	"chat-system/config"
+	"chat-system/models"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxPinnedMessages 每个会话最多置顶的消息数
+const maxPinnedMessages = 10
+
+var (
+	ErrPinLimitReached = fmt.Errorf("a conversation can have at most %d pinned messages", maxPinnedMessages)
+	ErrAlreadyPinned   = errors.New("message is already pinned")
+	ErrNotPinned       = errors.New("message is not pinned")
+)
+
+// PinnedMessageView 置顶消息及其置顶信息
+type PinnedMessageView struct {
+	PinnedBy string      `json:"pinned_by"`
+	PinnedAt time.Time   `json:"pinned_at"`
+	Message  MessageView `json:"message"`
+}
+
+// PinMessage 置顶消息：群聊需要 pin 权限（管理员及以上），私聊双方均可
+func PinMessage(userID string, messageID uint) (*models.PinnedMessage, error) {
+	message, err := loadPinnableMessage(userID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if message.Recalled {
+		return nil, ErrMessageRecalled
+	}
+
+	pin := models.PinnedMessage{
+		ConversationID: message.ConversationID,
+		MessageID:      message.ID,
+		PinnedBy:       userID,
+	}
+	// 锁住会话行再计数和写入，并发置顶按顺序执行，不会超过上限
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		var conversation models.Conversation
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("conversation_id = ?", message.ConversationID).First(&conversation).Error; err != nil {
+			return err
+		}
+
+		var count int64
+		if err := tx.Model(&models.PinnedMessage{}).Where("conversation_id = ?", message.ConversationID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count >= maxPinnedMessages {
+			return ErrPinLimitReached
+		}
+
+		result := tx.Where(models.PinnedMessage{MessageID: message.ID}).FirstOrCreate(&pin)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrAlreadyPinned
+		}
+		return nil
+	})
+	if errors.Is(err, ErrPinLimitReached) || errors.Is(err, ErrAlreadyPinned) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to pin message: %w", err)
+	}
+
+	notifyConversation(message.ConversationID, EventPin, PinEvent{
+		ConversationID: message.ConversationID,
+		MessageID:      message.ID,
+		UserID:         userID,
+		At:             pin.PinnedAt,
+	})
+	return &pin, nil
+}
+
+// UnpinMessage 取消置顶，权限与置顶相同
+func UnpinMessage(userID string, messageID uint) error {
+	message, err := loadPinnableMessage(userID, messageID)
+	if err != nil {
+		return err
+	}
+
+	result := config.DB.Where("message_id = ?", message.ID).Delete(&models.PinnedMessage{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to unpin message: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotPinned
+	}
+
+	notifyConversation(message.ConversationID, EventUnpin, PinEvent{
+		ConversationID: message.ConversationID,
+		MessageID:      message.ID,
+		UserID:         userID,
+		At:             time.Now(),
+	})
+	return nil
+}
+
+// GetPinnedMessages 返回会话的置顶消息，最新置顶的在前
+func GetPinnedMessages(conversationID string) ([]PinnedMessageView, error) {
+	var pins []models.PinnedMessage
+	if err := config.DB.Where("conversation_id = ?", conversationID).Order("id DESC").Find(&pins).Error; err != nil {
+		return nil, fmt.Errorf("failed to load pinned messages: %w", err)
+	}
+
+	messageIDs := make([]uint, 0, len(pins))
+	for _, pin := range pins {
+		messageIDs = append(messageIDs, pin.MessageID)
+	}
+	var messages []models.Message
+	if len(messageIDs) > 0 {
+		if err := config.DB.Where("id IN ?", messageIDs).Find(&messages).Error; err != nil {
+			return nil, fmt.Errorf("failed to load pinned messages: %w", err)
+		}
+	}
+	viewsByID := make(map[uint]MessageView, len(messages))
+	for _, view := range BuildMessageViews(messages) {
+		viewsByID[view.ID] = view
+	}
+
+	result := make([]PinnedMessageView, 0, len(pins))
+	for _, pin := range pins {
+		view, ok := viewsByID[pin.MessageID]
+		if !ok {
+			continue
+		}
+		result = append(result, PinnedMessageView{PinnedBy: pin.PinnedBy, PinnedAt: pin.PinnedAt, Message: view})
+	}
+	return result, nil
+}
+
+// loadPinnableMessage 查询消息并校验置顶权限
+func loadPinnableMessage(userID string, messageID uint) (*models.Message, error) {
+	message, err := GetMessageByID(messageID)
+	if err != nil {
+		return nil, err
+	}
+	conversation, err := GetConversationByID(message.ConversationID)
+	if err != nil {
+		return nil, err
+	}
+
+	if conversation.GroupID != "" {
+		if _, err := CheckGroupPermission(conversation.GroupID, userID, PermPin); err != nil {
+			return nil, err
+		}
+	} else if conversation.ParticipantA != userID && conversation.ParticipantB != userID {
+		return nil, ErrNotConversationMember
+	}
+	return message, nil
+}
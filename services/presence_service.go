@@ -0,0 +1,317 @@
+package services
+
+import (
+	"chat-system/config"
+	"chat-system/models"
+	"errors"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// maxPresenceSubscriptions 单次订阅或查询的用户数上限
+const maxPresenceSubscriptions = 200
+
+var ErrInvalidPresenceStatus = errors.New("status must be online or away")
+
+// PresenceSnapshot 某个用户当前的在线状态
+type PresenceSnapshot struct {
+	UserID   string     `json:"user_id"`
+	Status   string     `json:"status"`
+	LastSeen *time.Time `json:"last_seen,omitempty"`
+}
+
+type presenceState struct {
+	status       string
+	connections  int
+	lastSeen     *time.Time
+	offlineTimer *time.Timer // 宽限期计时，到期后才真正离线
+}
+
+// PresenceTracker 根据 WebSocket 连接维护用户的 online / away / offline 状态
+type PresenceTracker struct {
+	mu            sync.Mutex
+	states        map[string]*presenceState
+	subscribers   map[string]map[string]struct{} // 被订阅者 -> 订阅者
+	subscriptions map[string]map[string]struct{} // 订阅者 -> 被订阅者
+}
+
+// Presence 全局的在线状态跟踪
+var Presence = &PresenceTracker{
+	states:        make(map[string]*presenceState),
+	subscribers:   make(map[string]map[string]struct{}),
+	subscriptions: make(map[string]map[string]struct{}),
+}
+
+// ResetPresence 服务启动时把没有任何活跃连接却仍是在线状态的用户置为离线，需在 ResetConnections 之后调用
+func ResetPresence() {
+	if err := config.DB.Model(&models.User{}).
+		Where("status <> ?", models.UserStatusOffline).
+		Where("id NOT IN (?)", config.DB.Model(&models.WSConnection{}).Select("user_id")).
+		Update("status", models.UserStatusOffline).Error; err != nil {
+		log.Println("Failed to reset presence:", err)
+	}
+}
+
+// Connected 用户新建一个连接；第一个连接上线时广播 online，宽限期内重连不产生变化
+func (t *PresenceTracker) Connected(userID string) {
+	t.mu.Lock()
+	state, exists := t.states[userID]
+	if !exists {
+		state = &presenceState{status: models.UserStatusOffline}
+		t.states[userID] = state
+	}
+	state.connections++
+	if state.offlineTimer != nil {
+		state.offlineTimer.Stop()
+		state.offlineTimer = nil
+	}
+	changed := state.status == models.UserStatusOffline
+	if changed {
+		state.status = models.UserStatusOnline
+	}
+	t.mu.Unlock()
+
+	if changed {
+		go t.publish(userID)
+	}
+}
+
+// Disconnected 用户断开一个连接；最后一个连接断开后等待宽限期再标记离线
+func (t *PresenceTracker) Disconnected(userID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	state, exists := t.states[userID]
+	if !exists || state.connections == 0 {
+		return
+	}
+	state.connections--
+	if state.connections > 0 {
+		return
+	}
+
+	var timer *time.Timer
+	timer = time.AfterFunc(config.PresenceGracePeriod(), func() { t.goOffline(userID, timer) })
+	state.offlineTimer = timer
+}
+
+// goOffline 宽限期结束仍没有连接，标记离线并清理该用户的订阅
+func (t *PresenceTracker) goOffline(userID string, timer *time.Timer) {
+	t.mu.Lock()
+	state, exists := t.states[userID]
+	if !exists || state.offlineTimer != timer || state.connections > 0 {
+		t.mu.Unlock()
+		return
+	}
+	state.offlineTimer = nil
+	t.unsubscribeAllLocked(userID)
+	t.mu.Unlock()
+
+	// 用户仍连在其他节点上，只清理本节点的状态
+	if Manager.connectedElsewhere(userID) {
+		t.mu.Lock()
+		if current, ok := t.states[userID]; ok && current == state && state.connections == 0 {
+			delete(t.states, userID)
+		}
+		t.mu.Unlock()
+		return
+	}
+
+	t.mu.Lock()
+	if current, ok := t.states[userID]; !ok || current != state || state.connections > 0 {
+		t.mu.Unlock()
+		return
+	}
+	now := time.Now()
+	state.status = models.UserStatusOffline
+	state.lastSeen = &now
+	t.mu.Unlock()
+
+	t.publish(userID)
+}
+
+// SetStatus 客户端主动切换 online / away（如窗口失去焦点），需要有活跃连接
+func (t *PresenceTracker) SetStatus(userID, status string) error {
+	if status != models.UserStatusOnline && status != models.UserStatusAway {
+		return ErrInvalidPresenceStatus
+	}
+
+	t.mu.Lock()
+	state, exists := t.states[userID]
+	if !exists || state.connections == 0 || state.status == status {
+		t.mu.Unlock()
+		return nil
+	}
+	state.status = status
+	t.mu.Unlock()
+
+	t.publish(userID)
+	return nil
+}
+
+// Subscribe 订阅联系人的状态变化，返回当前状态快照；非联系人会被忽略
+func (t *PresenceTracker) Subscribe(subscriberID string, userIDs []string) ([]PresenceSnapshot, error) {
+	contactIDs, err := filterContacts(subscriberID, userIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	t.mu.Lock()
+	if t.subscriptions[subscriberID] == nil {
+		t.subscriptions[subscriberID] = make(map[string]struct{})
+	}
+	for _, userID := range contactIDs {
+		if t.subscribers[userID] == nil {
+			t.subscribers[userID] = make(map[string]struct{})
+		}
+		t.subscribers[userID][subscriberID] = struct{}{}
+		t.subscriptions[subscriberID][userID] = struct{}{}
+	}
+	t.mu.Unlock()
+
+	return t.Snapshot(contactIDs)
+}
+
+// ContactSnapshot 查询联系人的当前状态但不订阅，非联系人会被忽略
+func (t *PresenceTracker) ContactSnapshot(userID string, userIDs []string) ([]PresenceSnapshot, error) {
+	contactIDs, err := filterContacts(userID, userIDs)
+	if err != nil {
+		return nil, err
+	}
+	return t.Snapshot(contactIDs)
+}
+
+// Unsubscribe 取消订阅
+func (t *PresenceTracker) Unsubscribe(subscriberID string, userIDs []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, userID := range userIDs {
+		delete(t.subscribers[userID], subscriberID)
+		if len(t.subscribers[userID]) == 0 {
+			delete(t.subscribers, userID)
+		}
+		delete(t.subscriptions[subscriberID], userID)
+	}
+	if len(t.subscriptions[subscriberID]) == 0 {
+		delete(t.subscriptions, subscriberID)
+	}
+}
+
+func (t *PresenceTracker) unsubscribeAllLocked(subscriberID string) {
+	for userID := range t.subscriptions[subscriberID] {
+		delete(t.subscribers[userID], subscriberID)
+		if len(t.subscribers[userID]) == 0 {
+			delete(t.subscribers, userID)
+		}
+	}
+	delete(t.subscriptions, subscriberID)
+}
+
+// Snapshot 查询用户当前状态：内存中有记录的以内存为准，其余读取数据库中的最后在线时间
+func (t *PresenceTracker) Snapshot(userIDs []string) ([]PresenceSnapshot, error) {
+	snapshots := make([]PresenceSnapshot, 0, len(userIDs))
+	missing := make([]string, 0)
+
+	t.mu.Lock()
+	for _, userID := range userIDs {
+		if state, ok := t.states[userID]; ok {
+			snapshots = append(snapshots, PresenceSnapshot{UserID: userID, Status: state.status, LastSeen: state.lastSeen})
+		} else {
+			missing = append(missing, userID)
+		}
+	}
+	t.mu.Unlock()
+
+	if len(missing) > 0 {
+		var users []models.User
+		if err := config.DB.Select("id", "last_seen").Where("id IN ?", missing).Find(&users).Error; err != nil {
+			return nil, err
+		}
+		for _, user := range users {
+			snapshots = append(snapshots, PresenceSnapshot{
+				UserID:   strconv.FormatUint(uint64(user.ID), 10),
+				Status:   models.UserStatusOffline,
+				LastSeen: user.LastSeen,
+			})
+		}
+	}
+	return snapshots, nil
+}
+
+// publish 持久化当前状态并广播给各节点上的订阅者
+func (t *PresenceTracker) publish(userID string) {
+	t.mu.Lock()
+	state, exists := t.states[userID]
+	if !exists {
+		t.mu.Unlock()
+		return
+	}
+	snapshot := PresenceSnapshot{UserID: userID, Status: state.status, LastSeen: state.lastSeen}
+	if state.status == models.UserStatusOffline {
+		// 离线用户的状态已经落库，释放内存
+		delete(t.states, userID)
+	}
+	t.mu.Unlock()
+
+	updates := map[string]interface{}{"status": snapshot.Status}
+	if snapshot.Status == models.UserStatusOffline {
+		updates["last_seen"] = snapshot.LastSeen
+	}
+	if err := config.DB.Model(&models.User{}).Where("id = ?", userID).Updates(updates).Error; err != nil {
+		log.Println("Failed to persist presence:", err)
+	}
+
+	Manager.publishPresence(snapshot)
+}
+
+// notifySubscribers 推送给本节点上订阅了该用户的连接
+func (t *PresenceTracker) notifySubscribers(snapshot PresenceSnapshot) {
+	t.mu.Lock()
+	subscriberIDs := make([]string, 0, len(t.subscribers[snapshot.UserID]))
+	for subscriberID := range t.subscribers[snapshot.UserID] {
+		subscriberIDs = append(subscriberIDs, subscriberID)
+	}
+	t.mu.Unlock()
+
+	if len(subscriberIDs) > 0 {
+		Manager.sendLocalEvent(subscriberIDs, EventPresence, snapshot)
+	}
+}
+
+// filterContacts 从候选用户中筛出与 userID 有私聊会话或同在一个群的用户
+func filterContacts(userID string, candidateIDs []string) ([]string, error) {
+	if len(candidateIDs) > maxPresenceSubscriptions {
+		candidateIDs = candidateIDs[:maxPresenceSubscriptions]
+	}
+	if len(candidateIDs) == 0 {
+		return []string{}, nil
+	}
+
+	var privateA, privateB, groupPeers []string
+	if err := config.DB.Model(&models.Conversation{}).
+		Where("participant_a = ? AND participant_b IN ?", userID, candidateIDs).
+		Pluck("participant_b", &privateA).Error; err != nil {
+		return nil, err
+	}
+	if err := config.DB.Model(&models.Conversation{}).
+		Where("participant_b = ? AND participant_a IN ?", userID, candidateIDs).
+		Pluck("participant_a", &privateB).Error; err != nil {
+		return nil, err
+	}
+	myGroups := config.DB.Model(&models.GroupMember{}).Select("group_id").Where("user_id = ?", userID)
+	if err := config.DB.Model(&models.GroupMember{}).
+		Where("group_id IN (?) AND user_id IN ?", myGroups, candidateIDs).
+		Distinct().Pluck("user_id", &groupPeers).Error; err != nil {
+		return nil, err
+	}
+
+	contacts := make([]string, 0, len(candidateIDs))
+	for _, id := range append(append(privateA, privateB...), groupPeers...) {
+		if id != userID && !containsID(contacts, id) {
+			contacts = append(contacts, id)
+		}
+	}
+	return contacts, nil
+}
@@ -0,0 +1,122 @@
+package services
+
+import (
+	"chat-system/config"
+	"chat-system/models"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxEmojiLength 单个表情的最大字符数（组合表情可能由多个码点组成）
+const maxEmojiLength = 16
+
+var ErrInvalidEmoji = errors.New("invalid emoji")
+
+// ReactionSummary 按表情聚合的回应
+type ReactionSummary struct {
+	Emoji   string   `json:"emoji"`
+	Count   int      `json:"count"`
+	UserIDs []string `json:"user_ids"`
+}
+
+// AddReaction 给消息添加表情回应，已存在时不重复添加
+func AddReaction(userID string, messageID uint, emoji string) error {
+	message, err := loadReactableMessage(userID, messageID, emoji)
+	if err != nil {
+		return err
+	}
+
+	reaction := models.MessageReaction{MessageID: message.ID, UserID: userID, Emoji: emoji}
+	result := config.DB.Where(reaction).FirstOrCreate(&reaction)
+	if result.Error != nil {
+		return fmt.Errorf("failed to add reaction: %w", result.Error)
+	}
+	if result.RowsAffected > 0 {
+		notifyReaction(message, userID, emoji, "add")
+	}
+	return nil
+}
+
+// RemoveReaction 取消自己的表情回应
+func RemoveReaction(userID string, messageID uint, emoji string) error {
+	message, err := loadReactableMessage(userID, messageID, emoji)
+	if err != nil {
+		return err
+	}
+
+	result := config.DB.Where("message_id = ? AND user_id = ? AND emoji = ?", message.ID, userID, emoji).
+		Delete(&models.MessageReaction{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to remove reaction: %w", result.Error)
+	}
+	if result.RowsAffected > 0 {
+		notifyReaction(message, userID, emoji, "remove")
+	}
+	return nil
+}
+
+// GetReactionSummaries 批量查询消息的回应，按表情聚合，保持首次出现的顺序
+func GetReactionSummaries(messageIDs []uint) (map[uint][]ReactionSummary, error) {
+	summaries := make(map[uint][]ReactionSummary, len(messageIDs))
+	if len(messageIDs) == 0 {
+		return summaries, nil
+	}
+
+	var reactions []models.MessageReaction
+	if err := config.DB.Where("message_id IN ?", messageIDs).Order("id ASC").Find(&reactions).Error; err != nil {
+		return nil, fmt.Errorf("failed to load reactions: %w", err)
+	}
+
+	for _, reaction := range reactions {
+		list := summaries[reaction.MessageID]
+		found := false
+		for i := range list {
+			if list[i].Emoji == reaction.Emoji {
+				list[i].Count++
+				list[i].UserIDs = append(list[i].UserIDs, reaction.UserID)
+				found = true
+				break
+			}
+		}
+		if !found {
+			list = append(list, ReactionSummary{Emoji: reaction.Emoji, Count: 1, UserIDs: []string{reaction.UserID}})
+		}
+		summaries[reaction.MessageID] = list
+	}
+	return summaries, nil
+}
+
+// loadReactableMessage 校验表情和会话成员身份，已撤回的消息不能回应
+func loadReactableMessage(userID string, messageID uint, emoji string) (*models.Message, error) {
+	if strings.TrimSpace(emoji) == "" || utf8.RuneCountInString(emoji) > maxEmojiLength {
+		return nil, ErrInvalidEmoji
+	}
+	message, err := GetMessageByID(messageID)
+	if err != nil {
+		return nil, err
+	}
+	if message.Recalled {
+		return nil, ErrMessageRecalled
+	}
+	conversation, err := GetConversationByID(message.ConversationID)
+	if err != nil {
+		return nil, err
+	}
+	if isMember, _ := IsConversationMember(conversation, userID); !isMember {
+		return nil, ErrNotConversationMember
+	}
+	return message, nil
+}
+
+// notifyReaction 推送回应变化给会话全部成员
+func notifyReaction(message *models.Message, userID, emoji, action string) {
+	notifyConversation(message.ConversationID, EventReaction, ReactionEvent{
+		MessageID:      message.ID,
+		ConversationID: message.ConversationID,
+		UserID:         userID,
+		Emoji:          emoji,
+		Action:         action,
+	})
+}
@@ -0,0 +1,175 @@
+package services
+
+import (
+	"chat-system/config"
+	"chat-system/models"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// MarkConversationRead 推进用户在会话中的已读游标。
+// messageID 为 0 时表示读到会话最新一条消息；游标只会前进，不会后退。
+// 返回最新的参与者记录以及游标是否发生了变化。
+func MarkConversationRead(conversationID, userID string, messageID uint) (*models.ConversationParticipant, bool, error) {
+	conversation, err := GetConversationByID(conversationID)
+	if err != nil {
+		return nil, false, err
+	}
+	isMember, err := IsConversationMember(conversation, userID)
+	if err != nil {
+		return nil, false, err
+	}
+	if !isMember {
+		return nil, false, errors.New("you are not part of this conversation")
+	}
+
+	// 校验消息属于该会话；未指定时取会话最新消息
+	var message models.Message
+	query := config.DB.Where("conversation_id = ?", conversationID)
+	if messageID > 0 {
+		query = query.Where("id = ?", messageID)
+	} else {
+		query = query.Order("id DESC")
+	}
+	if err := query.First(&message).Error; err != nil {
+		return nil, false, errors.New("message not found in this conversation")
+	}
+
+	participant := models.ConversationParticipant{ConversationID: conversationID, UserID: userID}
+	if err := config.DB.Where(participant).FirstOrCreate(&participant).Error; err != nil {
+		return nil, false, fmt.Errorf("failed to load read cursor: %w", err)
+	}
+
+	now := time.Now()
+	advanced := false
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		// 带条件更新保证并发下游标单调递增
+		result := tx.Model(&models.ConversationParticipant{}).
+			Where("conversation_id = ? AND user_id = ? AND last_read_message_id < ?", conversationID, userID, message.ID).
+			Updates(map[string]interface{}{"last_read_message_id": message.ID, "last_read": now})
+		if result.Error != nil {
+			return result.Error
+		}
+		advanced = result.RowsAffected > 0
+
+		// 私聊仍维护消息上的 is_read，只标记发给该用户的消息
+		if advanced && conversation.GroupID == "" {
+			return tx.Model(&models.Message{}).
+				Where("conversation_id = ? AND receiver_id = ? AND is_read = false AND id <= ?", conversationID, userID, message.ID).
+				Update("is_read", true).Error
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to update read cursor: %w", err)
+	}
+
+	if advanced {
+		participant.LastReadMessageID = message.ID
+		participant.LastRead = &now
+		notifyReadReceipt(conversation, &participant)
+
+		// 私聊中发给该用户的消息流转为 read；群聊通过已读成员列表展示
+		if conversation.GroupID == "" {
+			var readIDs []uint
+			config.DB.Model(&models.Message{}).
+				Where("conversation_id = ? AND receiver_id = ? AND id <= ? AND status IN ?",
+					conversationID, userID, message.ID, models.MessageStatusPredecessors(models.MessageStatusRead)).
+				Pluck("id", &readIDs)
+			if _, err := AdvanceMessageStatus(readIDs, models.MessageStatusRead); err != nil {
+				fmt.Println("Failed to mark messages as read:", err)
+			}
+		}
+	}
+	return &participant, advanced, nil
+}
+
+// notifyReadReceipt 把已读回执推送给会话内的其他成员
+func notifyReadReceipt(conversation *models.Conversation, participant *models.ConversationParticipant) {
+	memberIDs, err := GetConversationMemberIDs(conversation)
+	if err != nil {
+		fmt.Println("Failed to resolve read receipt recipients:", err)
+		return
+	}
+	Manager.SendEvent(excludeUser(memberIDs, participant.UserID), EventRead, ReadEvent{
+		ConversationID:    participant.ConversationID,
+		ReaderID:          participant.UserID,
+		LastReadMessageID: participant.LastReadMessageID,
+		ReadAt:            *participant.LastRead,
+	})
+}
+
+// MessageReader 已读某条消息的成员
+type MessageReader struct {
+	UserID   string     `json:"user_id"`
+	Username string     `json:"username"`
+	Avatar   string     `json:"avatar"`
+	ReadAt   *time.Time `json:"read_at"`
+}
+
+// GetMessageReadBy 返回已读到该消息的成员（不含发送者）
+func GetMessageReadBy(message *models.Message) ([]MessageReader, error) {
+	var participants []models.ConversationParticipant
+	if err := config.DB.
+		Where("conversation_id = ? AND user_id <> ? AND last_read_message_id >= ?", message.ConversationID, message.SenderID, message.ID).
+		Order("last_read ASC").
+		Find(&participants).Error; err != nil {
+		return nil, fmt.Errorf("failed to load readers: %w", err)
+	}
+
+	userIDs := make([]string, 0, len(participants))
+	for _, p := range participants {
+		userIDs = append(userIDs, p.UserID)
+	}
+	var users []models.User
+	if len(userIDs) > 0 {
+		config.DB.Where("id IN ?", userIDs).Find(&users)
+	}
+	usersByID := make(map[string]models.User, len(users))
+	for _, user := range users {
+		usersByID[fmt.Sprint(user.ID)] = user
+	}
+
+	readers := make([]MessageReader, 0, len(participants))
+	for _, p := range participants {
+		user := usersByID[p.UserID]
+		readers = append(readers, MessageReader{
+			UserID:   p.UserID,
+			Username: user.Username,
+			Avatar:   user.AvatarURL,
+			ReadAt:   p.LastRead,
+		})
+	}
+	return readers, nil
+}
+
+// GetUnreadCounts 统计用户在各会话中的未读消息数（已读游标之后、非自己发送的消息）
+func GetUnreadCounts(userID string, conversationIDs []string) (map[string]int64, error) {
+	counts := make(map[string]int64, len(conversationIDs))
+	if len(conversationIDs) == 0 {
+		return counts, nil
+	}
+
+	var rows []struct {
+		ConversationID string
+		Count          int64
+	}
+	err := config.DB.Table("messages").
+		Select("messages.conversation_id, COUNT(*) AS count").
+		Joins("LEFT JOIN conversation_participants cp ON cp.conversation_id = messages.conversation_id AND cp.user_id = ?", userID).
+		Where("messages.conversation_id IN ? AND messages.sender_id <> ? AND messages.deleted_at IS NULL", conversationIDs, userID).
+		Where("messages.id > COALESCE(cp.last_read_message_id, 0)").
+		Group("messages.conversation_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to count unread messages: %w", err)
+	}
+
+	for _, row := range rows {
+		counts[row.ConversationID] = row.Count
+	}
+	return counts, nil
+}
@@ -0,0 +1,101 @@
+package services
+
+import (
+	"chat-system/config"
+	"chat-system/models"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrRecallWindowExpired = errors.New("message can no longer be recalled")
+	ErrMessageRecalled     = errors.New("message has been recalled")
+)
+
+// RecallMessage 撤回消息（对所有人删除）：仅发送者在允许的时间窗口内可撤回，
+// 内容替换为空的撤回占位，同时清除编辑历史、表情回应、置顶、@ 提及和附件
+func RecallMessage(userID string, messageID uint) (*models.Message, error) {
+	message, err := GetMessageByID(messageID)
+	if err != nil {
+		return nil, err
+	}
+	if message.SenderID != userID {
+		return nil, ErrNotMessageSender
+	}
+	if message.Recalled {
+		return nil, ErrMessageRecalled
+	}
+	if time.Since(message.CreatedAt) > config.MessageRecallWindow() {
+		return nil, ErrRecallWindowExpired
+	}
+
+	now := time.Now()
+	var orphanedKeys []string
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("message_id = ?", message.ID).Delete(&models.MessageEdit{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("message_id = ?", message.ID).Delete(&models.MessageReaction{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("message_id = ?", message.ID).Delete(&models.PinnedMessage{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("message_id = ?", message.ID).Delete(&models.MessageMention{}).Error; err != nil {
+			return err
+		}
+		var err error
+		if orphanedKeys, err = unlinkMessageAttachments(tx, message.ID); err != nil {
+			return err
+		}
+		return tx.Model(message).Updates(map[string]interface{}{
+			"content":     "",
+			"recalled":    true,
+			"recalled_at": now,
+		}).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to recall message: %w", err)
+	}
+
+	deleteStoredFiles(orphanedKeys)
+	message.Content = ""
+	message.Recalled = true
+	message.RecalledAt = &now
+	unindexMessage(message.ID)
+	notifyConversation(message.ConversationID, EventRecalled, RecalledEvent{
+		MessageID:      message.ID,
+		ConversationID: message.ConversationID,
+		RecalledAt:     now,
+	})
+	return message, nil
+}
+
+// DeleteMessageForMe 仅对当前用户隐藏消息，其他成员不受影响
+func DeleteMessageForMe(userID string, messageID uint) error {
+	message, err := GetMessageByID(messageID)
+	if err != nil {
+		return err
+	}
+	conversation, err := GetConversationByID(message.ConversationID)
+	if err != nil {
+		return err
+	}
+	if isMember, _ := IsConversationMember(conversation, userID); !isMember {
+		return ErrNotConversationMember
+	}
+
+	deletion := models.MessageDeletion{MessageID: message.ID, UserID: userID}
+	if err := config.DB.Where(deletion).FirstOrCreate(&deletion).Error; err != nil {
+		return fmt.Errorf("failed to delete message: %w", err)
+	}
+	return nil
+}
+
+// hiddenMessageIDsQuery 返回用户“仅对我删除”的消息 ID 子查询
+func hiddenMessageIDsQuery(userID string) *gorm.DB {
+	return config.DB.Model(&models.MessageDeletion{}).Select("message_id").Where("user_id = ?", userID)
+}
@@ -0,0 +1,153 @@
+package services
+
+import (
+	"chat-system/config"
+	"chat-system/models"
+	"chat-system/search"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SearchIndex 当前使用的消息搜索索引，由 InitSearchIndex 根据配置创建
+var SearchIndex search.Index
+
+// searchBackfillBatch 启动时回填内存索引每批读取的消息数
+const searchBackfillBatch = 1000
+
+// InitSearchIndex 根据 SEARCH_BACKEND 初始化搜索索引
+func InitSearchIndex() {
+	switch config.SearchBackend() {
+	case "memory":
+		index := search.NewMemoryIndex()
+		backfillSearchIndex(index)
+		SearchIndex = index
+	default:
+		SearchIndex = search.NewMySQLIndex(config.DB)
+	}
+	log.Println("Search backend:", config.SearchBackend())
+}
+
+// backfillSearchIndex 内存索引随进程重启清空，启动时从数据库重新写入未撤回的消息
+func backfillSearchIndex(index search.Index) {
+	var batch []models.Message
+	indexed := 0
+	err := config.DB.Where("recalled = ?", false).FindInBatches(&batch, searchBackfillBatch, func(tx *gorm.DB, _ int) error {
+		for _, message := range batch {
+			if err := index.Index(message); err != nil {
+				return err
+			}
+		}
+		indexed += len(batch)
+		return nil
+	}).Error
+	if err != nil {
+		log.Println("Failed to backfill search index:", err)
+		return
+	}
+	log.Println("Search index backfilled with", indexed, "messages")
+}
+
+// indexMessage 新消息或编辑后的消息写入索引
+func indexMessage(message *models.Message) {
+	if SearchIndex == nil {
+		return
+	}
+	if err := SearchIndex.Index(*message); err != nil {
+		log.Println("Failed to index message:", err)
+	}
+}
+
+// unindexMessage 撤回的消息从索引中移除
+func unindexMessage(messageID uint) {
+	if SearchIndex == nil {
+		return
+	}
+	if err := SearchIndex.Remove(messageID); err != nil {
+		log.Println("Failed to remove message from index:", err)
+	}
+}
+
+var ErrEmptySearchQuery = errors.New("search query cannot be empty")
+
+// SearchParams 搜索参数
+type SearchParams struct {
+	Text           string
+	ConversationID string
+	SenderID       string
+	MessageType    string
+	From           *time.Time
+	To             *time.Time
+}
+
+// SearchHit 一条搜索结果
+type SearchHit struct {
+	Snippet string      `json:"snippet"` // 命中词附近的片段，命中词以 <em> 标记
+	Message MessageView `json:"message"`
+}
+
+// SearchMessages 在用户参与的会话中搜索消息，返回当前页结果和总数
+func SearchMessages(userID string, params SearchParams, offset, limit int) ([]SearchHit, int64, error) {
+	terms := search.Terms(params.Text)
+	if len(terms) == 0 {
+		return nil, 0, ErrEmptySearchQuery
+	}
+	if SearchIndex == nil {
+		return nil, 0, errors.New("search is not available")
+	}
+
+	// 搜索范围限定在用户参与的会话内
+	var conversationIDs []string
+	if err := UserConversationIDsQuery(userID).Pluck("conversation_id", &conversationIDs).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to load conversations: %w", err)
+	}
+	if params.ConversationID != "" {
+		if !containsID(conversationIDs, params.ConversationID) {
+			return nil, 0, ErrNotConversationMember
+		}
+		conversationIDs = []string{params.ConversationID}
+	}
+	// “仅对我删除”的消息交给索引在计数和分页前排除，保证总数准确、每页条数足够
+	var hiddenIDs []uint
+	if err := hiddenMessageIDsQuery(userID).Pluck("message_id", &hiddenIDs).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to load hidden messages: %w", err)
+	}
+
+	result, err := SearchIndex.Search(search.Query{
+		Text:            params.Text,
+		ConversationIDs: conversationIDs,
+		SenderID:        params.SenderID,
+		MessageType:     params.MessageType,
+		From:            params.From,
+		To:              params.To,
+		ExcludeIDs:      hiddenIDs,
+		Offset:          offset,
+		Limit:           limit,
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// 按索引返回的顺序组装结果
+	var messages []models.Message
+	if len(result.MessageIDs) > 0 {
+		config.DB.Where("id IN ?", result.MessageIDs).Find(&messages)
+	}
+	viewsByID := make(map[uint]MessageView, len(messages))
+	for _, view := range BuildMessageViews(messages) {
+		viewsByID[view.ID] = view
+	}
+
+	hits := make([]SearchHit, 0, len(result.MessageIDs))
+	for _, id := range result.MessageIDs {
+		view, ok := viewsByID[id]
+		if !ok {
+			continue
+		}
+		hits = append(hits, SearchHit{Snippet: search.Highlight(view.Content, terms), Message: view})
+	}
+	return hits, result.Total, nil
+}
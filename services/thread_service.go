@@ -0,0 +1,42 @@
+package services
+
+import (
+	"chat-system/config"
+	"chat-system/models"
+	"chat-system/utils"
+)
+
+// ThreadPage 话题视图：根消息及分页的回复
+type ThreadPage struct {
+	Root       MessageView   `json:"root"`
+	Replies    []MessageView `json:"replies"`
+	NextCursor uint          `json:"next_cursor"`
+	HasMore    bool          `json:"has_more"`
+}
+
+// GetThread 返回消息所在话题的根消息及回复。
+// 回复默认从最早一条开始按时间正序翻页（after），也可用 before 向前翻。
+func GetThread(messageID uint, viewerID string, page utils.CursorPagination) (*ThreadPage, error) {
+	root, err := GetMessageByID(messageID)
+	if err != nil {
+		return nil, err
+	}
+	if root.ThreadRootID != nil {
+		if root, err = GetMessageByID(*root.ThreadRootID); err != nil {
+			return nil, err
+		}
+	}
+
+	query := config.DB.Where("thread_root_id = ? AND id NOT IN (?)", root.ID, hiddenMessageIDsQuery(viewerID))
+	replies, err := queryMessagePage(query, page, page.Before == 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ThreadPage{
+		Root:       BuildMessageViews([]models.Message{*root})[0],
+		Replies:    replies.Messages,
+		NextCursor: replies.NextCursor,
+		HasMore:    replies.HasMore,
+	}, nil
+}
@@ -0,0 +1,109 @@
+package services
+
+import (
+	"bytes"
+	"chat-system/config"
+	"chat-system/models"
+	"fmt"
+	"image"
+	"io"
+	"log"
+)
+
+// thumbnailSizes 生成的缩略图尺寸，按最长边限制
+var thumbnailSizes = []struct {
+	Name    string
+	MaxEdge int
+}{
+	{"small", 200},  // 会话列表、消息气泡
+	{"medium", 800}, // 点开预览
+}
+
+// ThumbnailView 返回给客户端的缩略图
+type ThumbnailView struct {
+	URL    string `json:"url"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+// generateThumbnails 为图片附件生成各尺寸缩略图，失败时只记录日志，不影响上传
+func generateThumbnails(attachment *models.Attachment, img *image.RGBA) []models.AttachmentThumbnail {
+	thumbnails := make([]models.AttachmentThumbnail, 0, len(thumbnailSizes))
+	for _, size := range thumbnailSizes {
+		resized := resizeImage(img, size.MaxEdge)
+		data, mimeType, err := encodeThumbnail(resized, attachment.MimeType)
+		if err != nil {
+			log.Println("Failed to encode thumbnail:", err)
+			continue
+		}
+
+		thumbnail := models.AttachmentThumbnail{
+			AttachmentID: attachment.ID,
+			Size:         size.Name,
+			MimeType:     mimeType,
+			Width:        resized.Bounds().Dx(),
+			Height:       resized.Bounds().Dy(),
+			ByteSize:     int64(len(data)),
+			StorageKey:   attachment.StorageKey + "_" + size.Name,
+		}
+		if err := FileStorage.Save(thumbnail.StorageKey, bytes.NewReader(data)); err != nil {
+			log.Println("Failed to store thumbnail:", err)
+			continue
+		}
+		if err := config.DB.Create(&thumbnail).Error; err != nil {
+			log.Println("Failed to save thumbnail:", err)
+			continue
+		}
+		thumbnails = append(thumbnails, thumbnail)
+	}
+	return thumbnails
+}
+
+// loadThumbnails 批量查询附件的缩略图
+func loadThumbnails(attachmentIDs []uint) map[uint][]models.AttachmentThumbnail {
+	result := make(map[uint][]models.AttachmentThumbnail)
+	if len(attachmentIDs) == 0 {
+		return result
+	}
+
+	var thumbnails []models.AttachmentThumbnail
+	if err := config.DB.Where("attachment_id IN ?", attachmentIDs).Find(&thumbnails).Error; err != nil {
+		log.Println("Failed to load thumbnails:", err)
+		return result
+	}
+	for _, thumbnail := range thumbnails {
+		result[thumbnail.AttachmentID] = append(result[thumbnail.AttachmentID], thumbnail)
+	}
+	return result
+}
+
+// loadThumbnailsForMessages 查询一批消息附件中图片的缩略图
+func loadThumbnailsForMessages(attachments map[uint][]models.Attachment) map[uint][]models.AttachmentThumbnail {
+	attachmentIDs := make([]uint, 0)
+	for _, list := range attachments {
+		for _, attachment := range list {
+			if attachment.Width > 0 {
+				attachmentIDs = append(attachmentIDs, attachment.ID)
+			}
+		}
+	}
+	return loadThumbnails(attachmentIDs)
+}
+
+// OpenThumbnail 打开指定尺寸的缩略图，调用方负责关闭
+func OpenThumbnail(attachmentID, size string) (*models.AttachmentThumbnail, io.ReadCloser, error) {
+	attachment, err := GetAttachmentByID(attachmentID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var thumbnail models.AttachmentThumbnail
+	if err := config.DB.Where("attachment_id = ? AND size = ?", attachment.ID, size).First(&thumbnail).Error; err != nil {
+		return nil, nil, ErrAttachmentNotFound
+	}
+	reader, err := FileStorage.Open(thumbnail.StorageKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open thumbnail: %w", err)
+	}
+	return &thumbnail, reader, nil
+}
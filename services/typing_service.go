@@ -0,0 +1,161 @@
+package services
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	typingThrottle   = 3 * time.Second  // 同一用户在同一会话内最多每 3 秒转发一次 typing_start
+	typingTimeout    = 6 * time.Second  // 超过该时间没有新的 typing_start 视为停止输入
+	typingMembersTTL = 30 * time.Second // 会话成员缓存时间，避免每次按键都查库
+)
+
+type typingKey struct {
+	ConversationID string
+	UserID         string
+}
+
+type typingState struct {
+	lastRelay time.Time
+	timer     *time.Timer
+}
+
+type cachedMembers struct {
+	memberIDs []string
+	expiresAt time.Time
+}
+
+// TypingTracker 记录正在输入的用户，只保存在内存中，不写数据库
+type TypingTracker struct {
+	mu      sync.Mutex
+	states  map[typingKey]*typingState
+	members map[string]cachedMembers
+}
+
+// Typing 全局的输入状态跟踪
+var Typing = &TypingTracker{
+	states:  make(map[typingKey]*typingState),
+	members: make(map[string]cachedMembers),
+}
+
+// Start 用户开始输入：节流后转发给会话内其他成员，并在超时后自动发出停止
+func (t *TypingTracker) Start(conversationID, userID string) error {
+	memberIDs, err := t.memberIDs(conversationID)
+	if err != nil {
+		return err
+	}
+	if !containsID(memberIDs, userID) {
+		return ErrNotConversationMember
+	}
+
+	key := typingKey{ConversationID: conversationID, UserID: userID}
+	t.mu.Lock()
+	state, exists := t.states[key]
+	if exists {
+		state.timer.Reset(typingTimeout)
+		if time.Since(state.lastRelay) < typingThrottle {
+			t.mu.Unlock()
+			return nil
+		}
+	} else {
+		state = &typingState{}
+		state.timer = time.AfterFunc(typingTimeout, func() { t.expire(key, state) })
+		t.states[key] = state
+	}
+	state.lastRelay = time.Now()
+	t.mu.Unlock()
+
+	relayTyping(memberIDs, conversationID, userID, true)
+	return nil
+}
+
+// Stop 用户停止输入或已发出消息，之前没有在输入时不做任何事
+func (t *TypingTracker) Stop(conversationID, userID string) {
+	key := typingKey{ConversationID: conversationID, UserID: userID}
+	t.mu.Lock()
+	state, exists := t.states[key]
+	if exists {
+		state.timer.Stop()
+		delete(t.states, key)
+	}
+	t.mu.Unlock()
+
+	if exists {
+		t.relayStop(key)
+	}
+}
+
+// expire 超时未收到 typing_start，自动发出停止
+func (t *TypingTracker) expire(key typingKey, state *typingState) {
+	t.mu.Lock()
+	// 期间可能已经 Stop 后又重新 Start，只清理属于自己的那次
+	current, exists := t.states[key]
+	if !exists || current != state {
+		t.mu.Unlock()
+		return
+	}
+	delete(t.states, key)
+	t.mu.Unlock()
+
+	t.relayStop(key)
+}
+
+func (t *TypingTracker) relayStop(key typingKey) {
+	memberIDs, err := t.memberIDs(key.ConversationID)
+	if err != nil {
+		return
+	}
+	relayTyping(memberIDs, key.ConversationID, key.UserID, false)
+}
+
+// memberIDs 查询会话成员，结果缓存一小段时间
+func (t *TypingTracker) memberIDs(conversationID string) ([]string, error) {
+	t.mu.Lock()
+	cached, ok := t.members[conversationID]
+	t.mu.Unlock()
+	if ok && time.Now().Before(cached.expiresAt) {
+		return cached.memberIDs, nil
+	}
+
+	conversation, err := GetConversationByID(conversationID)
+	if err != nil {
+		return nil, err
+	}
+	memberIDs, err := GetConversationMemberIDs(conversation)
+	if err != nil {
+		return nil, err
+	}
+
+	t.mu.Lock()
+	now := time.Now()
+	for id, entry := range t.members {
+		if now.After(entry.expiresAt) {
+			delete(t.members, id)
+		}
+	}
+	t.members[conversationID] = cachedMembers{memberIDs: memberIDs, expiresAt: now.Add(typingMembersTTL)}
+	t.mu.Unlock()
+	return memberIDs, nil
+}
+
+// InvalidateMembers 群成员变化后丢弃所有节点上的缓存，被移出的成员不再收到输入状态
+func (t *TypingTracker) InvalidateMembers(conversationID string) {
+	Manager.publishInvalidation(invalidateTypingMembers, conversationID)
+}
+
+// dropMembers 丢弃本节点的会话成员缓存
+func (t *TypingTracker) dropMembers(conversationID string) {
+	t.mu.Lock()
+	delete(t.members, conversationID)
+	t.mu.Unlock()
+}
+
+// relayTyping 推送给会话内除输入者以外的在线成员
+func relayTyping(memberIDs []string, conversationID, userID string, typing bool) {
+	Manager.SendEvent(excludeUser(memberIDs, userID), EventTyping, TypingEvent{
+		ConversationID: conversationID,
+		UserID:         userID,
+		Typing:         typing,
+	})
+}
@@ -9,8 +9,14 @@ import (
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
+	"github.com/google/uuid"
 )
 
+// tokenTTL 登录 token 的有效期
+const tokenTTL = 24 * time.Hour
+
+var ErrTokenRevoked = errors.New("token has been signed out")
+
 var jwtKey = []byte(os.Getenv("JWT_SECRET")) // 使用环境变量获取密钥
 
 // Claims 是自定义的 JWT Claims 结构体
@@ -50,10 +56,11 @@ func CheckPassword(storedPassword, providedPassword string) bool {
 // GenerateToken 生成 JWT Token
 func GenerateToken(user models.User) (string, error) {
 	// 设置 Token 过期时间为 24 小时
-	expirationTime := time.Now().Add(24 * time.Hour)
+	expirationTime := time.Now().Add(tokenTTL)
 	claims := &Claims{
 		Username: user.Username,
 		StandardClaims: jwt.StandardClaims{
+			Id:        uuid.New().String(),   // 每次登录唯一，用于按设备吊销
 			ExpiresAt: expirationTime.Unix(), // 使用 Unix 时间戳表示过期时间
 			Issuer:    "my-gin-project",      // 可以设置为应用名称
 		},
@@ -97,6 +104,12 @@ func GetAllUser() ([]models.User, error) {
 
 // GetCurrentUser 根据提供的 token 获取当前用户信息
 func GetCurrentUser(tokenString string) (*models.User, error) {
+	user, _, err := AuthenticateToken(tokenString)
+	return user, err
+}
+
+// AuthenticateToken 校验 token 并返回用户和 token ID（jti），所在设备已被登出的 token 视为无效
+func AuthenticateToken(tokenString string) (*models.User, string, error) {
 	// 假设你的 JWT 密钥存在 config 中
 	secretKey := jwtKey
 
@@ -109,23 +122,31 @@ func GetCurrentUser(tokenString string) (*models.User, error) {
 		return []byte(secretKey), nil
 	})
 	if err != nil || !token.Valid {
-		return nil, errors.New("invalid or expired token")
+		return nil, "", errors.New("invalid or expired token")
 	}
 
 	// 从 token 中获取 Claims（即用户信息）
 	claims, ok := token.Claims.(jwt.MapClaims)
 	if !ok {
-		return nil, errors.New("invalid token claims")
+		return nil, "", errors.New("invalid token claims")
 	}
 
 	// 假设你的 token 中包含用户 ID 字段
-	username := claims["username"].(string)
+	username, ok := claims["username"].(string)
+	if !ok || username == "" {
+		return nil, "", errors.New("invalid token claims")
+	}
+	// 早期签发的 token 没有 jti，无法按设备吊销，过期后自然失效
+	tokenID, _ := claims["jti"].(string)
+	if tokenID != "" && isTokenRevoked(tokenID) {
+		return nil, "", ErrTokenRevoked
+	}
 
 	// 根据用户 ID 从数据库中查找用户
 	var user models.User
 	if err := config.DB.First(&user, "username = ?", username).Error; err != nil {
-		return nil, fmt.Errorf("user not found: %v", err)
+		return nil, "", fmt.Errorf("user not found: %v", err)
 	}
 
-	return &user, nil
+	return &user, tokenID, nil
 }
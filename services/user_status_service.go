@@ -0,0 +1,295 @@
+package services
+
+import (
+	"chat-system/config"
+	"chat-system/models"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+)
+
+const (
+	maxStatusTextLength  = 100
+	maxStatusEmojiLength = 16
+	maxDNDSchedules      = 20
+	// dndCacheTTL 免打扰设置的缓存时间，推送提醒类事件时逐个用户判断，避免每次查库
+	dndCacheTTL = time.Minute
+)
+
+var (
+	ErrStatusTooLong       = fmt.Errorf("status text must be at most %d characters", maxStatusTextLength)
+	ErrInvalidStatusEmoji  = errors.New("invalid status emoji")
+	ErrExpiryInPast        = errors.New("expiry must be in the future")
+	ErrInvalidDNDSchedule  = errors.New("invalid do-not-disturb schedule")
+	ErrTooManyDNDSchedules = fmt.Errorf("at most %d do-not-disturb schedules are allowed", maxDNDSchedules)
+)
+
+// CustomStatus 用户自定义状态
+type CustomStatus struct {
+	Text      string     `json:"text"`
+	Emoji     string     `json:"emoji"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// ActiveCustomStatus 返回未过期的自定义状态，未设置或已过期时返回 nil
+func ActiveCustomStatus(user *models.User) *CustomStatus {
+	if user.StatusText == "" && user.StatusEmoji == "" {
+		return nil
+	}
+	if user.StatusExpiresAt != nil && !time.Now().Before(*user.StatusExpiresAt) {
+		return nil
+	}
+	return &CustomStatus{Text: user.StatusText, Emoji: user.StatusEmoji, ExpiresAt: user.StatusExpiresAt}
+}
+
+// SetCustomStatus 设置自定义状态，文字和表情都为空时清除
+func SetCustomStatus(userID uint, text, emoji string, expiresAt *time.Time) (*CustomStatus, error) {
+	text, emoji = strings.TrimSpace(text), strings.TrimSpace(emoji)
+	if utf8.RuneCountInString(text) > maxStatusTextLength {
+		return nil, ErrStatusTooLong
+	}
+	if utf8.RuneCountInString(emoji) > maxStatusEmojiLength || strings.ContainsAny(emoji, " \t\n") {
+		return nil, ErrInvalidStatusEmoji
+	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return nil, ErrExpiryInPast
+	}
+	if text == "" && emoji == "" {
+		expiresAt = nil
+	}
+
+	if err := config.DB.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"status_text":       text,
+		"status_emoji":      emoji,
+		"status_expires_at": expiresAt,
+	}).Error; err != nil {
+		return nil, fmt.Errorf("failed to update status: %w", err)
+	}
+	if text == "" && emoji == "" {
+		return nil, nil
+	}
+	return &CustomStatus{Text: text, Emoji: emoji, ExpiresAt: expiresAt}, nil
+}
+
+// DNDScheduleInput 定时免打扰，时间为 "HH:MM"，days 为 0（周日）到 6（周六）
+type DNDScheduleInput struct {
+	Days     []int  `json:"days"`
+	Start    string `json:"start"`
+	End      string `json:"end"`
+	Timezone string `json:"timezone"`
+}
+
+// DNDScheduleView 返回给客户端的定时免打扰
+type DNDScheduleView struct {
+	Days     []int  `json:"days"`
+	Start    string `json:"start"`
+	End      string `json:"end"`
+	Timezone string `json:"timezone"`
+}
+
+// DNDSettings 用户的免打扰设置，active 表示当前是否处于免打扰
+type DNDSettings struct {
+	Enabled   bool              `json:"enabled"`
+	Until     *time.Time        `json:"until,omitempty"`
+	Schedules []DNDScheduleView `json:"schedules"`
+	Active    bool              `json:"active"`
+}
+
+type dndCacheEntry struct {
+	user      models.User
+	schedules []models.DNDSchedule
+	loadedAt  time.Time
+}
+
+var (
+	dndCache   = make(map[string]dndCacheEntry)
+	dndCacheMu sync.Mutex
+)
+
+// SetDND 更新免打扰设置，schedules 整体替换
+func SetDND(userID uint, enabled bool, until *time.Time, inputs []DNDScheduleInput) (*DNDSettings, error) {
+	if until != nil && !until.After(time.Now()) {
+		return nil, ErrExpiryInPast
+	}
+	if !enabled {
+		until = nil
+	}
+	if len(inputs) > maxDNDSchedules {
+		return nil, ErrTooManyDNDSchedules
+	}
+	schedules := make([]models.DNDSchedule, 0, len(inputs))
+	for _, input := range inputs {
+		schedule, err := parseDNDSchedule(userID, input)
+		if err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, schedule)
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+			"dnd_enabled": enabled,
+			"dnd_until":   until,
+		}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&models.DNDSchedule{}).Error; err != nil {
+			return err
+		}
+		if len(schedules) > 0 {
+			return tx.Create(&schedules).Error
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to update do-not-disturb: %w", err)
+	}
+
+	// 其他节点上的缓存一并失效，新设置立即对所有节点生效
+	Manager.publishInvalidation(invalidateDND, strconv.FormatUint(uint64(userID), 10))
+	return GetDNDSettings(userID)
+}
+
+// dropDNDCache 丢弃本节点缓存的免打扰设置
+func dropDNDCache(userID string) {
+	dndCacheMu.Lock()
+	delete(dndCache, userID)
+	dndCacheMu.Unlock()
+}
+
+// GetDNDSettings 查询免打扰设置
+func GetDNDSettings(userID uint) (*DNDSettings, error) {
+	var user models.User
+	if err := config.DB.First(&user, userID).Error; err != nil {
+		return nil, fmt.Errorf("user not found: %w", err)
+	}
+	var schedules []models.DNDSchedule
+	if err := config.DB.Where("user_id = ?", userID).Order("id ASC").Find(&schedules).Error; err != nil {
+		return nil, fmt.Errorf("failed to load schedules: %w", err)
+	}
+
+	settings := &DNDSettings{
+		Enabled:   user.DNDEnabled,
+		Until:     user.DNDUntil,
+		Schedules: make([]DNDScheduleView, 0, len(schedules)),
+		Active:    dndActive(&user, schedules, time.Now()),
+	}
+	for _, schedule := range schedules {
+		settings.Schedules = append(settings.Schedules, newDNDScheduleView(schedule))
+	}
+	return settings, nil
+}
+
+// IsInDND 判断用户当前是否处于免打扰，设置有短暂缓存
+func IsInDND(userID string) bool {
+	dndCacheMu.Lock()
+	entry, ok := dndCache[userID]
+	dndCacheMu.Unlock()
+
+	if !ok || time.Since(entry.loadedAt) > dndCacheTTL {
+		entry = dndCacheEntry{loadedAt: time.Now()}
+		if err := config.DB.Select("id", "dnd_enabled", "dnd_until").First(&entry.user, userID).Error; err != nil {
+			return false
+		}
+		if err := config.DB.Where("user_id = ?", userID).Find(&entry.schedules).Error; err != nil {
+			return false
+		}
+		dndCacheMu.Lock()
+		dndCache[userID] = entry
+		dndCacheMu.Unlock()
+	}
+	return dndActive(&entry.user, entry.schedules, time.Now())
+}
+
+// dndActive 手动开启且未到期，或当前时间落在任一定时时段内
+func dndActive(user *models.User, schedules []models.DNDSchedule, now time.Time) bool {
+	if user.DNDEnabled && (user.DNDUntil == nil || now.Before(*user.DNDUntil)) {
+		return true
+	}
+	for _, schedule := range schedules {
+		if scheduleActive(schedule, now) {
+			return true
+		}
+	}
+	return false
+}
+
+// scheduleActive 跨午夜的时段，午夜之后的部分算作前一天的时段
+func scheduleActive(schedule models.DNDSchedule, now time.Time) bool {
+	loc, err := time.LoadLocation(schedule.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	local := now.In(loc)
+	minute := local.Hour()*60 + local.Minute()
+	today := int(local.Weekday())
+	yesterday := (today + 6) % 7
+	onDay := func(day int) bool { return schedule.Weekdays&(1<<day) != 0 }
+
+	switch {
+	case schedule.StartMinute == schedule.EndMinute:
+		return onDay(today)
+	case schedule.StartMinute < schedule.EndMinute:
+		return onDay(today) && minute >= schedule.StartMinute && minute < schedule.EndMinute
+	default:
+		return (onDay(today) && minute >= schedule.StartMinute) || (onDay(yesterday) && minute < schedule.EndMinute)
+	}
+}
+
+func parseDNDSchedule(userID uint, input DNDScheduleInput) (models.DNDSchedule, error) {
+	schedule := models.DNDSchedule{UserID: userID, Timezone: input.Timezone}
+	if schedule.Timezone == "" {
+		schedule.Timezone = "UTC"
+	}
+	if _, err := time.LoadLocation(schedule.Timezone); err != nil {
+		return schedule, ErrInvalidDNDSchedule
+	}
+	if len(input.Days) == 0 {
+		return schedule, ErrInvalidDNDSchedule
+	}
+	for _, day := range input.Days {
+		if day < 0 || day > 6 {
+			return schedule, ErrInvalidDNDSchedule
+		}
+		schedule.Weekdays |= 1 << day
+	}
+
+	var err error
+	if schedule.StartMinute, err = parseClock(input.Start); err != nil {
+		return schedule, ErrInvalidDNDSchedule
+	}
+	if schedule.EndMinute, err = parseClock(input.End); err != nil {
+		return schedule, ErrInvalidDNDSchedule
+	}
+	return schedule, nil
+}
+
+// parseClock 解析 "HH:MM" 为当天的分钟数
+func parseClock(value string) (int, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func newDNDScheduleView(schedule models.DNDSchedule) DNDScheduleView {
+	view := DNDScheduleView{
+		Days:     make([]int, 0, 7),
+		Start:    fmt.Sprintf("%02d:%02d", schedule.StartMinute/60, schedule.StartMinute%60),
+		End:      fmt.Sprintf("%02d:%02d", schedule.EndMinute/60, schedule.EndMinute%60),
+		Timezone: schedule.Timezone,
+	}
+	for day := 0; day < 7; day++ {
+		if schedule.Weekdays&(1<<day) != 0 {
+			view.Days = append(view.Days, day)
+		}
+	}
+	return view
+}
@@ -0,0 +1,345 @@
+package services
+
+import (
+	"chat-system/bus"
+	"chat-system/config"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+)
+
+const (
+	nodeChannelPrefix = "ws:node:"      // 每个节点订阅自己的频道，接收需要投递给本节点连接的数据
+	presenceChannel   = "ws:presence"   // 在线状态变化广播给所有节点
+	invalidateChannel = "ws:invalidate" // 节点本地缓存失效广播给所有节点
+	nodeAliveInterval = 10 * time.Second
+	nodeAliveTTL      = 30 * time.Second
+)
+
+// 节点间转发的指令类型
+const (
+	clusterDeliver          = "deliver"           // 写入用户在该节点上的连接
+	clusterDisconnectDevice = "disconnect_device" // 关闭用户某个设备在该节点上的连接
+)
+
+// 需要跨节点失效的本地缓存
+const (
+	invalidateTypingMembers = "typing_members" // 输入状态使用的会话成员缓存，key 为会话 ID
+	invalidateDND           = "dnd"            // 免打扰设置缓存，key 为用户 ID
+)
+
+// cacheInvalidation 缓存失效通知
+type cacheInvalidation struct {
+	Kind string `json:"kind"`
+	Key  string `json:"key"`
+}
+
+// clusterEnvelope 节点间转发的数据
+type clusterEnvelope struct {
+	Kind               string          `json:"kind"`
+	UserID             string          `json:"user_id,omitempty"`  // disconnect_device 的用户
+	UserIDs            []string        `json:"user_ids,omitempty"` // deliver 的接收者，同一节点上的用户合并为一条
+	ExceptConnectionID string          `json:"except_connection_id,omitempty"`
+	Payload            json.RawMessage `json:"payload,omitempty"`
+	DeviceID           string          `json:"device_id,omitempty"`
+	Code               int             `json:"code,omitempty"`
+	Reason             string          `json:"reason,omitempty"`
+}
+
+// InitBus 根据 BUS_BACKEND 创建总线、连接位置表和票据存储并接入 Manager
+func InitBus() error {
+	var (
+		messageBus bus.Bus
+		registry   bus.Registry
+	)
+	switch config.BusBackend() {
+	case "redis":
+		redisBus, err := bus.NewRedisBus(config.RedisAddr(), config.RedisPassword())
+		if err != nil {
+			return fmt.Errorf("failed to connect redis bus: %w", err)
+		}
+		messageBus = redisBus
+		registry = bus.NewRedisRegistry(config.RedisAddr(), config.RedisPassword())
+		wsTickets = bus.NewRedisTicketStore(config.RedisAddr(), config.RedisPassword())
+	default:
+		messageBus = bus.NewMemoryBus()
+		registry = bus.NewMemoryRegistry()
+	}
+	log.Println("Message bus:", config.BusBackend(), "node:", config.NodeID())
+	return Manager.UseBus(config.NodeID(), messageBus, registry)
+}
+
+// UseBus 接入总线：订阅本节点频道和在线状态频道，并清理本节点上次运行残留的位置记录。
+// 需在 Run 之前调用
+func (m *WSManager) UseBus(nodeID string, messageBus bus.Bus, registry bus.Registry) error {
+	m.nodeID = nodeID
+	m.bus = messageBus
+	m.registry = registry
+	m.pendingLocations = make(map[string]bool)
+	m.locationSignal = make(chan struct{}, 1)
+
+	if err := registry.ResetNode(nodeID); err != nil {
+		log.Println("Failed to reset node registry:", err)
+	}
+	if err := registry.KeepAlive(nodeID, nodeAliveTTL); err != nil {
+		log.Println("Failed to mark node alive:", err)
+	}
+	if err := messageBus.Subscribe(nodeChannelPrefix+nodeID, m.handleNodeMessage); err != nil {
+		return err
+	}
+	if err := messageBus.Subscribe(presenceChannel, handlePresenceMessage); err != nil {
+		return err
+	}
+	if err := messageBus.Subscribe(invalidateChannel, handleInvalidationMessage); err != nil {
+		return err
+	}
+	go m.keepAlive()
+	go m.syncLocations()
+	return nil
+}
+
+// keepAlive 定期刷新节点存活标记，节点宕机后其他节点不再向它转发
+func (m *WSManager) keepAlive() {
+	ticker := time.NewTicker(nodeAliveInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := m.registry.KeepAlive(m.nodeID, nodeAliveTTL); err != nil {
+			log.Println("Failed to refresh node alive:", err)
+		}
+	}
+}
+
+// markLocation 用户在本节点的第一个连接建立或最后一个连接断开，交给 syncLocations 异步写入位置表，
+// Run 循环不等待 Redis
+func (m *WSManager) markLocation(userID string) {
+	if m.registry == nil {
+		return
+	}
+	m.locationMu.Lock()
+	m.pendingLocations[userID] = true
+	m.locationMu.Unlock()
+
+	select {
+	case m.locationSignal <- struct{}{}:
+	default:
+	}
+}
+
+// syncLocations 把待同步的用户按本节点当前的连接情况写入位置表。
+// 同一用户的多次变化合并为一次写入，以写入时的连接状态为准，不会因乱序留下错误记录
+func (m *WSManager) syncLocations() {
+	for range m.locationSignal {
+		m.locationMu.Lock()
+		pending := m.pendingLocations
+		m.pendingLocations = make(map[string]bool)
+		m.locationMu.Unlock()
+
+		for userID := range pending {
+			m.mu.Lock()
+			connected := len(m.clients[userID]) > 0
+			m.mu.Unlock()
+
+			var err error
+			if connected {
+				err = m.registry.Add(userID, m.nodeID)
+			} else {
+				err = m.registry.Remove(userID, m.nodeID)
+			}
+			if err != nil {
+				log.Println("Failed to sync connection location of", userID, ":", err)
+			}
+		}
+	}
+}
+
+// userRoutes 一次推送的接收者位置：本节点上有连接的用户，以及其他节点上有连接的用户（按节点分组）
+type userRoutes struct {
+	local  []string
+	remote map[string][]string
+}
+
+// locateAll 一次查询所有接收者的位置，本节点的连接直接查内存
+func (m *WSManager) locateAll(userIDs []string) userRoutes {
+	routes := userRoutes{remote: make(map[string][]string)}
+	m.mu.Lock()
+	for _, userID := range userIDs {
+		if len(m.clients[userID]) > 0 {
+			routes.local = append(routes.local, userID)
+		}
+	}
+	m.mu.Unlock()
+
+	if m.registry == nil || len(userIDs) == 0 {
+		return routes
+	}
+	located, err := m.registry.Locate(userIDs)
+	if err != nil {
+		log.Println("Failed to locate users:", err)
+		return routes
+	}
+	for userID, nodeIDs := range located {
+		for _, nodeID := range nodeIDs {
+			if nodeID != m.nodeID {
+				routes.remote[nodeID] = append(routes.remote[nodeID], userID)
+			}
+		}
+	}
+	return routes
+}
+
+// empty 所有接收者都不在线
+func (r userRoutes) empty() bool {
+	return len(r.local) == 0 && len(r.remote) == 0
+}
+
+// users 在线的接收者，每个用户只出现一次
+func (r userRoutes) users() []string {
+	seen := make(map[string]bool)
+	var users []string
+	for _, userID := range r.local {
+		if !seen[userID] {
+			seen[userID] = true
+			users = append(users, userID)
+		}
+	}
+	for _, userIDs := range r.remote {
+		for _, userID := range userIDs {
+			if !seen[userID] {
+				seen[userID] = true
+				users = append(users, userID)
+			}
+		}
+	}
+	return users
+}
+
+// split 按用户集合拆成两部分：在 selected 中的和不在的
+func (r userRoutes) split(selected map[string]bool) (in, out userRoutes) {
+	in = userRoutes{remote: make(map[string][]string)}
+	out = userRoutes{remote: make(map[string][]string)}
+	for _, userID := range r.local {
+		if selected[userID] {
+			in.local = append(in.local, userID)
+		} else {
+			out.local = append(out.local, userID)
+		}
+	}
+	for nodeID, userIDs := range r.remote {
+		for _, userID := range userIDs {
+			if selected[userID] {
+				in.remote[nodeID] = append(in.remote[nodeID], userID)
+			} else {
+				out.remote[nodeID] = append(out.remote[nodeID], userID)
+			}
+		}
+	}
+	return in, out
+}
+
+// connectedElsewhere 用户是否还在其他节点上有连接
+func (m *WSManager) connectedElsewhere(userID string) bool {
+	return len(m.locateAll([]string{userID}).remote) > 0
+}
+
+// forward 把指令发给其他节点
+func (m *WSManager) forward(nodeIDs []string, envelope clusterEnvelope) {
+	if len(nodeIDs) == 0 {
+		return
+	}
+	payload, err := json.Marshal(envelope)
+	if err != nil {
+		log.Println("Failed to marshal cluster envelope:", err)
+		return
+	}
+	for _, nodeID := range nodeIDs {
+		if err := m.bus.Publish(nodeChannelPrefix+nodeID, payload); err != nil {
+			log.Println("Failed to forward to node", nodeID, ":", err)
+		}
+	}
+}
+
+// handleNodeMessage 处理其他节点转发来的指令，只操作本节点的连接
+func (m *WSManager) handleNodeMessage(payload []byte) {
+	var envelope clusterEnvelope
+	if err := json.Unmarshal(payload, &envelope); err != nil {
+		log.Println("Invalid cluster envelope:", err)
+		return
+	}
+
+	switch envelope.Kind {
+	case clusterDeliver:
+		for _, userID := range envelope.UserIDs {
+			if err := m.sendLocal(userID, envelope.ExceptConnectionID, envelope.Payload); err != nil {
+				fmt.Println("Failed to deliver forwarded message to", userID, ":", err)
+			}
+		}
+	case clusterDisconnectDevice:
+		m.disconnectLocalDevice(envelope.UserID, envelope.DeviceID, envelope.Code, envelope.Reason)
+	default:
+		log.Println("Unknown cluster envelope kind:", envelope.Kind)
+	}
+}
+
+// publishPresence 在线状态变化广播给所有节点，由各节点推送给本节点上的订阅者
+func (m *WSManager) publishPresence(snapshot PresenceSnapshot) {
+	if m.bus == nil {
+		Presence.notifySubscribers(snapshot)
+		return
+	}
+	payload, err := json.Marshal(snapshot)
+	if err != nil {
+		log.Println("Failed to marshal presence:", err)
+		return
+	}
+	if err := m.bus.Publish(presenceChannel, payload); err != nil {
+		log.Println("Failed to publish presence:", err)
+	}
+}
+
+func handlePresenceMessage(payload []byte) {
+	var snapshot PresenceSnapshot
+	if err := json.Unmarshal(payload, &snapshot); err != nil {
+		log.Println("Invalid presence message:", err)
+		return
+	}
+	Presence.notifySubscribers(snapshot)
+}
+
+// publishInvalidation 丢弃本节点的缓存，并通知其他节点丢弃各自的缓存
+func (m *WSManager) publishInvalidation(kind, key string) {
+	invalidation := cacheInvalidation{Kind: kind, Key: key}
+	applyInvalidation(invalidation)
+	if m.bus == nil {
+		return
+	}
+	payload, err := json.Marshal(invalidation)
+	if err != nil {
+		log.Println("Failed to marshal cache invalidation:", err)
+		return
+	}
+	if err := m.bus.Publish(invalidateChannel, payload); err != nil {
+		log.Println("Failed to publish cache invalidation:", err)
+	}
+}
+
+func handleInvalidationMessage(payload []byte) {
+	var invalidation cacheInvalidation
+	if err := json.Unmarshal(payload, &invalidation); err != nil {
+		log.Println("Invalid cache invalidation:", err)
+		return
+	}
+	applyInvalidation(invalidation)
+}
+
+// applyInvalidation 丢弃本节点的缓存，重复执行没有副作用
+func applyInvalidation(invalidation cacheInvalidation) {
+	switch invalidation.Kind {
+	case invalidateTypingMembers:
+		Typing.dropMembers(invalidation.Key)
+	case invalidateDND:
+		dropDNDCache(invalidation.Key)
+	default:
+		log.Println("Unknown cache invalidation kind:", invalidation.Kind)
+	}
+}
@@ -0,0 +1,171 @@
+package services
+
+import (
+	"chat-system/bus"
+	"chat-system/models"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// newTestNode 创建一个接入共享总线的节点，返回节点和它的 WebSocket 地址。
+// 握手时用 user_id 参数代替鉴权，连接直接挂到节点上，不经过 Run（Run 会写数据库）
+func newTestNode(t *testing.T, nodeID string, messageBus bus.Bus, registry bus.Registry) (*WSManager, string) {
+	t.Helper()
+	m := newWSManager()
+	if err := m.UseBus(nodeID, messageBus, registry); err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		userID, _ := strconv.ParseUint(r.URL.Query().Get("user_id"), 10, 64)
+		client := newClient(conn, &models.User{ID: uint(userID)}, "", r)
+
+		m.mu.Lock()
+		m.clients[client.ID] = append(m.clients[client.ID], client)
+		m.mu.Unlock()
+		m.markLocation(client.ID)
+	}))
+	t.Cleanup(server.Close)
+	return m, "ws" + strings.TrimPrefix(server.URL, "http")
+}
+
+func dial(t *testing.T, url string) *websocket.Conn {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// waitLocated 等待位置表异步写入完成
+func waitLocated(t *testing.T, registry bus.Registry, userID, nodeID string) {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		located, err := registry.Locate([]string{userID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, id := range located[userID] {
+			if id == nodeID {
+				return
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("user %s was not registered on node %s", userID, nodeID)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestClusterRemoteDeliver(t *testing.T) {
+	messageBus, registry := bus.NewMemoryBus(), bus.NewMemoryRegistry()
+	nodeA, _ := newTestNode(t, "a", messageBus, registry)
+	_, urlB := newTestNode(t, "b", messageBus, registry)
+
+	// 用户 1 的两个设备都连在节点 b 上，用户 2 离线
+	phone := dial(t, urlB+"?user_id=1&device_id=phone")
+	laptop := dial(t, urlB+"?user_id=1&device_id=laptop")
+	waitLocated(t, registry, "1", "b")
+
+	nodeA.SendEvent([]string{"1", "2"}, EventTyping, map[string]string{"conversation_id": "c1"})
+
+	for _, conn := range []*websocket.Conn{phone, laptop} {
+		conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var event struct {
+			Type string            `json:"type"`
+			Data map[string]string `json:"data"`
+		}
+		if err := json.Unmarshal(data, &event); err != nil {
+			t.Fatal(err)
+		}
+		if event.Type != EventTyping || event.Data["conversation_id"] != "c1" {
+			t.Errorf("unexpected event %s", data)
+		}
+	}
+}
+
+func TestClusterRemoteDisconnectDevice(t *testing.T) {
+	messageBus, registry := bus.NewMemoryBus(), bus.NewMemoryRegistry()
+	nodeA, _ := newTestNode(t, "a", messageBus, registry)
+	_, urlB := newTestNode(t, "b", messageBus, registry)
+
+	phone := dial(t, urlB+"?user_id=1&device_id=phone")
+	laptop := dial(t, urlB+"?user_id=1&device_id=laptop")
+	waitLocated(t, registry, "1", "b")
+
+	nodeA.DisconnectDevice("1", "phone", CloseSignedOut, "signed out")
+
+	phone.SetReadDeadline(time.Now().Add(3 * time.Second))
+	_, _, err := phone.ReadMessage()
+	var closeErr *websocket.CloseError
+	if !errors.As(err, &closeErr) || closeErr.Code != CloseSignedOut {
+		t.Fatalf("phone: got %v, want close code %d", err, CloseSignedOut)
+	}
+
+	// 同一用户的其他设备不受影响
+	laptop.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	_, _, err = laptop.ReadMessage()
+	if netErr, ok := err.(interface{ Timeout() bool }); !ok || !netErr.Timeout() {
+		t.Errorf("laptop: got %v, want read timeout", err)
+	}
+}
+
+func TestClusterTypingMembersInvalidation(t *testing.T) {
+	messageBus, registry := bus.NewMemoryBus(), bus.NewMemoryRegistry()
+	newTestNode(t, "a", messageBus, registry)
+
+	Typing.mu.Lock()
+	Typing.members["c1"] = cachedMembers{memberIDs: []string{"1", "2"}, expiresAt: time.Now().Add(time.Minute)}
+	Typing.mu.Unlock()
+
+	// 其他节点上的成员变化通过总线通知到本节点
+	payload, _ := json.Marshal(cacheInvalidation{Kind: invalidateTypingMembers, Key: "c1"})
+	if err := messageBus.Publish(invalidateChannel, payload); err != nil {
+		t.Fatal(err)
+	}
+	Typing.mu.Lock()
+	_, cached := Typing.members["c1"]
+	Typing.mu.Unlock()
+	if cached {
+		t.Error("typing members cache was not invalidated")
+	}
+}
+
+func TestClusterDNDInvalidation(t *testing.T) {
+	messageBus, registry := bus.NewMemoryBus(), bus.NewMemoryRegistry()
+	newTestNode(t, "a", messageBus, registry)
+
+	dndCacheMu.Lock()
+	dndCache["1"] = dndCacheEntry{loadedAt: time.Now()}
+	dndCacheMu.Unlock()
+
+	payload, _ := json.Marshal(cacheInvalidation{Kind: invalidateDND, Key: "1"})
+	if err := messageBus.Publish(invalidateChannel, payload); err != nil {
+		t.Fatal(err)
+	}
+	dndCacheMu.Lock()
+	_, cached := dndCache["1"]
+	dndCacheMu.Unlock()
+	if cached {
+		t.Error("do-not-disturb cache was not invalidated")
+	}
+}
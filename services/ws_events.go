@@ -0,0 +1,206 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// 服务端主动推送的事件类型
+const (
+	EventRead     = "read"     // 已读回执
+	EventStatus   = "status"   // 消息状态变化，推送给发送者
+	EventSync     = "sync"     // 断线重连后补发的消息
+	EventAck      = "ack"      // 发送确认，回传服务端消息 ID 和时间
+	EventEdited   = "edited"   // 消息被编辑
+	EventRecalled = "recalled" // 消息被撤回
+	EventReaction = "reaction" // 表情回应增减
+	EventPin      = "pin"      // 消息被置顶
+	EventUnpin    = "unpin"    // 消息取消置顶
+	EventMention  = "mention"  // 被 @ 提及
+	EventTyping   = "typing"   // 会话内其他成员开始或停止输入
+	EventPresence = "presence" // 订阅的联系人在线状态变化
+
+	EventPresenceSnapshot = "presence_snapshot" // 订阅时返回的当前状态
+	EventError            = "error"             // 客户端帧处理失败
+)
+
+// WSEvent 服务端推送的事件帧，消息本身仍以 MessageView 原样推送
+type WSEvent struct {
+	Type   string      `json:"type"`
+	Data   interface{} `json:"data"`
+	Silent bool        `json:"silent,omitempty"` // 接收方处于免打扰，客户端应同步状态但不提醒
+}
+
+// ReadEvent 已读回执：reader 已读到 last_read_message_id
+type ReadEvent struct {
+	ConversationID    string    `json:"conversation_id"`
+	ReaderID          string    `json:"reader_id"`
+	LastReadMessageID uint      `json:"last_read_message_id"`
+	ReadAt            time.Time `json:"read_at"`
+}
+
+// StatusEvent 消息状态变化
+type StatusEvent struct {
+	ConversationID string `json:"conversation_id"`
+	MessageIDs     []uint `json:"message_ids,omitempty"`
+	ClientMsgID    string `json:"client_msg_id,omitempty"` // 发送失败时回传，便于客户端定位
+	Status         string `json:"status"`
+}
+
+// AckEvent 发送确认
+type AckEvent struct {
+	ClientMsgID    string    `json:"client_msg_id,omitempty"`
+	MessageID      uint      `json:"message_id"`
+	ConversationID string    `json:"conversation_id"`
+	Status         string    `json:"status"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// SyncEvent 一批补发的消息，has_more 为 true 时客户端应以 next_cursor 继续同步
+type SyncEvent struct {
+	Messages   []MessageView `json:"messages"`
+	NextCursor uint          `json:"next_cursor"`
+	HasMore    bool          `json:"has_more"`
+}
+
+// EditedEvent 消息被编辑
+type EditedEvent struct {
+	MessageID      uint      `json:"message_id"`
+	ConversationID string    `json:"conversation_id"`
+	EditorID       string    `json:"editor_id"`
+	Content        string    `json:"content"`
+	EditedAt       time.Time `json:"edited_at"`
+}
+
+// RecalledEvent 消息被撤回
+type RecalledEvent struct {
+	MessageID      uint      `json:"message_id"`
+	ConversationID string    `json:"conversation_id"`
+	RecalledAt     time.Time `json:"recalled_at"`
+}
+
+// ReactionEvent 表情回应变化，action 为 add 或 remove
+type ReactionEvent struct {
+	MessageID      uint   `json:"message_id"`
+	ConversationID string `json:"conversation_id"`
+	UserID         string `json:"user_id"`
+	Emoji          string `json:"emoji"`
+	Action         string `json:"action"`
+}
+
+// PinEvent 置顶或取消置顶
+type PinEvent struct {
+	ConversationID string    `json:"conversation_id"`
+	MessageID      uint      `json:"message_id"`
+	UserID         string    `json:"user_id"` // 操作者
+	At             time.Time `json:"at"`
+}
+
+// MentionEvent 被 @ 提及
+type MentionEvent struct {
+	MessageID      uint   `json:"message_id"`
+	ConversationID string `json:"conversation_id"`
+	SenderID       string `json:"sender_id"`
+	IsAll          bool   `json:"is_all"`
+}
+
+// TypingEvent 输入状态，typing 为 false 表示停止输入（包括超时自动停止）
+type TypingEvent struct {
+	ConversationID string `json:"conversation_id"`
+	UserID         string `json:"user_id"`
+	Typing         bool   `json:"typing"`
+}
+
+// ErrorEvent 客户端帧处理失败时回给该连接
+type ErrorEvent struct {
+	Action  string `json:"action"` // 出错的帧类型
+	Message string `json:"message"`
+}
+
+// notificationEvents 提醒类事件，免打扰期间照常推送但标记为 silent，客户端据此同步状态、不弹提醒
+var notificationEvents = map[string]bool{
+	EventMention:  true,
+	EventReaction: true,
+	EventPin:      true,
+	EventUnpin:    true,
+}
+
+// SendEvent 向多个用户的在线连接推送事件，离线用户跳过；免打扰中的用户收到的提醒类事件带 silent 标记
+func (m *WSManager) SendEvent(userIDs []string, eventType string, data interface{}) {
+	payload, err := json.Marshal(WSEvent{Type: eventType, Data: data})
+	if err != nil {
+		fmt.Println("Error marshaling event:", err)
+		return
+	}
+	routes := m.locateAll(userIDs)
+	if routes.empty() {
+		return
+	}
+
+	if notificationEvents[eventType] {
+		silent := make(map[string]bool)
+		for _, userID := range routes.users() {
+			if IsInDND(userID) {
+				silent[userID] = true
+			}
+		}
+		if len(silent) > 0 {
+			silentPayload, err := json.Marshal(WSEvent{Type: eventType, Data: data, Silent: true})
+			if err != nil {
+				fmt.Println("Error marshaling event:", err)
+				return
+			}
+			var silentRoutes userRoutes
+			silentRoutes, routes = routes.split(silent)
+			if err := m.deliver(silentRoutes, "", silentPayload); err != nil {
+				fmt.Println("Failed to send silent event:", err)
+			}
+		}
+	}
+	if err := m.deliver(routes, "", payload); err != nil {
+		fmt.Println("Failed to send event:", err)
+	}
+}
+
+// excludeUser 返回去掉指定用户后的列表
+func excludeUser(userIDs []string, userID string) []string {
+	result := make([]string, 0, len(userIDs))
+	for _, id := range userIDs {
+		if id != userID {
+			result = append(result, id)
+		}
+	}
+	return result
+}
+
+// sendLocalEvent 只推送给本节点上的连接
+func (m *WSManager) sendLocalEvent(userIDs []string, eventType string, data interface{}) {
+	payload, err := json.Marshal(WSEvent{Type: eventType, Data: data})
+	if err != nil {
+		fmt.Println("Error marshaling event:", err)
+		return
+	}
+	for _, userID := range userIDs {
+		if err := m.sendLocal(userID, "", payload); err != nil {
+			fmt.Println("Failed to send event to", userID, ":", err)
+		}
+	}
+}
+
+// sendEvent 只向当前这一个连接推送事件
+func (c *Client) sendEvent(eventType string, data interface{}) error {
+	payload, err := json.Marshal(WSEvent{Type: eventType, Data: data})
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.Conn == nil {
+		return fmt.Errorf("connection closed")
+	}
+	return c.Conn.WriteMessage(websocket.TextMessage, payload)
+}
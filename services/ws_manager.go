@@ -1,7 +1,7 @@
 package services
 
 import (
-	"chat-system/config"
+	"chat-system/bus"
 	"chat-system/models"
 	"encoding/json"
 	"fmt"
@@ -24,6 +24,13 @@ type Client struct {
 	LastPing  time.Time
 	mu        sync.Mutex
 	closeOnce sync.Once
+
+	ConnectionID string // 每个连接唯一
+	DeviceID     string // 同一设备的多个连接共享
+	DeviceName   string
+	Platform     string
+	ConnectedAt  time.Time
+	TokenID      string // 握手使用的登录 token（jti）
 }
 
 type WSManager struct {
@@ -32,21 +39,44 @@ type WSManager struct {
 	unregister chan *Client
 	broadcast  chan []byte
 	mu         sync.Mutex
+
+	// 多节点部署时由 UseBus 设置；为空时只投递本节点的连接
+	nodeID   string
+	bus      bus.Bus
+	registry bus.Registry
+
+	// 待写入位置表的用户，由 syncLocations 在 Run 循环之外处理
+	locationMu       sync.Mutex
+	pendingLocations map[string]bool
+	locationSignal   chan struct{}
 }
 
-var Manager = &WSManager{
-	clients:    make(map[string][]*Client),
-	register:   make(chan *Client),
-	unregister: make(chan *Client),
-	broadcast:  make(chan []byte),
+var Manager = newWSManager()
+
+func newWSManager() *WSManager {
+	return &WSManager{
+		clients:    make(map[string][]*Client),
+		register:   make(chan *Client),
+		unregister: make(chan *Client),
+		broadcast:  make(chan []byte),
+	}
 }
 
 type Message struct {
-	Type           string `json:"type"` // "broadcast" 或 "private"
-	To             string `json:"to,omitempty"`
-	Content        string `json:"content"`
-	ConversationID string `json:"conversation_id"`
-	ReadId         uint   `json:"readId"`
+	Type           string   `json:"type"` // "private"、"group"、"updateRead"、"ack"、"sync"、"edit"、"typing_start"、"typing_stop" 或 "presence*"
+	To             string   `json:"to,omitempty"`
+	Content        string   `json:"content"`
+	ConversationID string   `json:"conversation_id"`
+	ReadId         uint     `json:"readId"`
+	MessageIDs     []uint   `json:"message_ids,omitempty"`    // ack 帧确认收到的消息
+	LastMessageID  uint     `json:"last_message_id"`          // sync 帧携带的同步游标
+	MessageType    string   `json:"message_type,omitempty"`   // 消息内容类型，缺省时沿用 type
+	ClientMsgID    string   `json:"client_msg_id,omitempty"`  // 客户端生成的幂等 ID
+	MessageID      uint     `json:"message_id,omitempty"`     // edit 等针对单条消息的帧
+	ReplyTo        uint     `json:"reply_to,omitempty"`       // 引用回复的消息 ID
+	AttachmentIDs  []string `json:"attachment_ids,omitempty"` // 先通过 /api/attachments 上传得到的附件 ID
+	Status         string   `json:"status,omitempty"`         // presence 帧上报的 online / away
+	UserIDs        []string `json:"user_ids,omitempty"`       // presence_subscribe / presence_unsubscribe 的用户
 }
 
 func (m *WSManager) Run() {
@@ -55,20 +85,28 @@ func (m *WSManager) Run() {
 		case client := <-m.register:
 			m.mu.Lock()
 			m.clients[client.ID] = append(m.clients[client.ID], client)
+			first := len(m.clients[client.ID]) == 1
 			m.mu.Unlock()
+			if first {
+				m.markLocation(client.ID)
+			}
+			Presence.Connected(client.ID)
 			fmt.Println("New client registered:", client.ID)
 			go client.StartHeartbeat()
 
 		case client := <-m.unregister:
+			last := false
 			m.mu.Lock()
 			if clients, ok := m.clients[client.ID]; ok {
 				for i, c := range clients {
 					if c == client {
 						m.clients[client.ID] = append(clients[:i], clients[i+1:]...)
+						Presence.Disconnected(client.ID)
 						break
 					}
 				}
-				if len(m.clients[client.ID]) == 0 {
+				last = len(m.clients[client.ID]) == 0
+				if last {
 					client.closeOnce.Do(func() {
 						defer func() {
 							if r := recover(); r != nil {
@@ -77,10 +115,14 @@ func (m *WSManager) Run() {
 						}()
 						close(client.Send)
 					})
+					delete(m.clients, client.ID)
 				}
 				fmt.Println("Client unregistered:", client.ID)
 			}
 			m.mu.Unlock()
+			if last {
+				m.markLocation(client.ID)
+			}
 
 		case msg := <-m.broadcast:
 			m.mu.Lock()
@@ -102,6 +144,7 @@ func (c *Client) ReadMessages() {
 	defer func() {
 		Manager.unregister <- c
 		c.CloseSendChannel()
+		removeConnection(c)
 
 		c.mu.Lock()
 		if c.Conn != nil {
@@ -129,50 +172,89 @@ func (c *Client) ReadMessages() {
 			continue
 		}
 
-		if data.Type == "updateRead" {
-			// 假设收到的消息中包含一个 MaxID 字段
-			maxID := data.ReadId // 最大 ID，表示更新所有 ID 小于等于该值的消息
-			err := updateMessagesAsReadByID(data.ConversationID, maxID)
-			if err != nil {
-				fmt.Println("Failed to update messages as read:", err)
-			} else {
-				fmt.Println("Successfully updated messages as read for conversation:", data.ConversationID)
+		switch data.Type {
+		case "updateRead":
+			// ReadId 为已读到的消息 ID，推进当前用户在该会话的已读游标
+			if _, _, err := MarkConversationRead(data.ConversationID, c.ID, data.ReadId); err != nil {
+				fmt.Println("Failed to update read cursor:", err)
 			}
-			return
-		}
-		if data.Type == "private" {
-			ReceiverID := getReceiverID(c.ID, data.ConversationID)
-			message := models.Message{
-				ConversationID: data.ConversationID,
-				SenderID:       c.ID,
-				ReceiverID:     ReceiverID,
-				Content:        data.Content,
-				MessageType:    data.Type,
-				Status:         "sent",
+		case "ack":
+			// 客户端确认收到消息，推进为 delivered
+			if err := AcknowledgeDelivery(c.ID, data.MessageIDs); err != nil {
+				fmt.Println("Failed to acknowledge messages:", err)
 			}
-			// 更新会话列表排序
-			if err := config.DB.Model(&models.Conversation{}).
-				Where("conversation_id = ?", data.ConversationID).
-				Update("last_message_at", time.Now()).Error; err != nil {
-				log.Println("Failed to update last_message_at:", err)
+		case "sync":
+			// 客户端重连后带上最后收到的消息 ID，补发之后的全部消息
+			c.syncMessages(data.LastMessageID)
+		case "private", "group":
+			c.handleChatMessage(data)
+		case "edit":
+			if _, err := EditMessage(c.ID, data.MessageID, data.Content); err != nil {
+				c.sendEvent(EventError, ErrorEvent{Action: data.Type, Message: err.Error()})
 			}
-			// 存储消息
-			if err := config.DB.Create(&message).Error; err != nil {
-				fmt.Println("Failed to send message")
-				return
+		case "typing_start":
+			if err := Typing.Start(data.ConversationID, c.ID); err != nil {
+				c.sendEvent(EventError, ErrorEvent{Action: data.Type, Message: err.Error()})
 			}
-			// ws推送消息
-			err := Manager.SendMessage(data.ConversationID, ReceiverID, message)
+		case "typing_stop":
+			Typing.Stop(data.ConversationID, c.ID)
+		case "presence":
+			// 客户端切到后台或回到前台时上报 away / online
+			if err := Presence.SetStatus(c.ID, data.Status); err != nil {
+				c.sendEvent(EventError, ErrorEvent{Action: data.Type, Message: err.Error()})
+			}
+		case "presence_subscribe":
+			snapshots, err := Presence.Subscribe(c.ID, data.UserIDs)
 			if err != nil {
-				fmt.Println("Failed to send private message:", err)
+				c.sendEvent(EventError, ErrorEvent{Action: data.Type, Message: err.Error()})
+				continue
 			}
-
-		} else {
-			Manager.broadcast <- msg
+			c.sendEvent(EventPresenceSnapshot, snapshots)
+		case "presence_unsubscribe":
+			Presence.Unsubscribe(c.ID, data.UserIDs)
+		default:
+			fmt.Println("Unknown message type:", data.Type)
 		}
 	}
 }
 
+// handleChatMessage 处理 private / group 发送帧，结果通过 ack 或 failed 状态回传给发送者
+func (c *Client) handleChatMessage(data Message) {
+	messageType := data.MessageType
+	if messageType == "" {
+		messageType = data.Type
+	}
+
+	message, _, err := SendChatMessage(c.ID, SendMessageInput{
+		ConversationID: data.ConversationID,
+		Content:        data.Content,
+		MessageType:    messageType,
+		ClientMsgID:    data.ClientMsgID,
+		ReplyToID:      data.ReplyTo,
+		AttachmentIDs:  data.AttachmentIDs,
+
+		OriginConnectionID: c.ConnectionID,
+	})
+	if err != nil {
+		log.Println("Failed to send message:", err)
+		c.sendEvent(EventStatus, StatusEvent{
+			ConversationID: data.ConversationID,
+			ClientMsgID:    data.ClientMsgID,
+			Status:         models.MessageStatusFailed,
+		})
+		return
+	}
+
+	// 重复提交同样回 ack，客户端据此拿到服务端的消息 ID 和时间
+	c.sendEvent(EventAck, AckEvent{
+		ClientMsgID:    message.ClientMsgID,
+		MessageID:      message.ID,
+		ConversationID: message.ConversationID,
+		Status:         message.Status,
+		CreatedAt:      message.CreatedAt,
+	})
+}
+
 func (c *Client) WriteMessages() {
 	defer func() {
 		c.closeOnce.Do(func() {
@@ -193,23 +275,64 @@ func (c *Client) WriteMessages() {
 }
 
 func (m *WSManager) SendMessage(ConversationId, clientID string, message models.Message) error {
-	m.mu.Lock()
-	clients, exists := m.clients[clientID]
-	m.mu.Unlock()
+	msg, err := json.Marshal(message)
+	if err != nil {
+		fmt.Println("Error marshaling message:", err)
+		return err
+	}
+	return m.sendRaw(clientID, msg)
+}
+
+// sendRaw 将已序列化的数据写入用户的所有连接
+func (m *WSManager) sendRaw(clientID string, msg []byte) error {
+	return m.sendRawExcept(clientID, "", msg)
+}
+
+// sendRawExcept 写入用户除 exceptConnectionID 以外的所有连接，包括其他节点上的连接
+func (m *WSManager) sendRawExcept(clientID, exceptConnectionID string, msg []byte) error {
+	return m.deliver(m.locateAll([]string{clientID}), exceptConnectionID, msg)
+}
 
-	if !exists {
-		return fmt.Errorf("client %s not found", clientID)
+// deliver 写入本节点的连接，并通过总线转发给接收者所在的其他节点，每个节点只转发一次。
+// 返回第一个本节点写入失败的错误，其余接收者照常投递
+func (m *WSManager) deliver(routes userRoutes, exceptConnectionID string, msg []byte) error {
+	for nodeID, userIDs := range routes.remote {
+		m.forward([]string{nodeID}, clusterEnvelope{
+			Kind:               clusterDeliver,
+			UserIDs:            userIDs,
+			ExceptConnectionID: exceptConnectionID,
+			Payload:            msg,
+		})
+	}
+
+	var firstErr error
+	for _, userID := range routes.local {
+		if err := m.sendLocal(userID, exceptConnectionID, msg); err != nil {
+			fmt.Println("Failed to deliver to", userID, ":", err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
 	}
+	return firstErr
+}
+
+// sendLocal 只写入本节点上的连接，用户在本节点没有连接时不做任何事
+func (m *WSManager) sendLocal(clientID, exceptConnectionID string, msg []byte) error {
+	m.mu.Lock()
+	clients := append([]*Client(nil), m.clients[clientID]...)
+	m.mu.Unlock()
 
 	for _, client := range clients {
+		if exceptConnectionID != "" && client.ConnectionID == exceptConnectionID {
+			continue
+		}
 		client.mu.Lock()
-		msg, err := json.Marshal(message)
-		if err != nil {
-			fmt.Println("Error marshaling message:", err)
+		if client.Conn == nil {
 			client.mu.Unlock()
-			return err
+			continue
 		}
-		err = client.Conn.WriteMessage(websocket.TextMessage, msg)
+		err := client.Conn.WriteMessage(websocket.TextMessage, msg)
 		client.mu.Unlock()
 
 		if err != nil {
@@ -223,6 +346,41 @@ func (m *WSManager) SendMessage(ConversationId, clientID string, message models.
 	return nil
 }
 
+// SendMessageToUsers 将消息推送给多个用户，离线用户跳过。
+// 推送内容与历史消息接口一致，包含附件等聚合信息
+func (m *WSManager) SendMessageToUsers(ConversationId string, userIDs []string, message models.Message) {
+	msg, err := marshalMessageView(message)
+	if err != nil {
+		fmt.Println("Error marshaling message:", err)
+		return
+	}
+	if err := m.deliver(m.locateAll(userIDs), "", msg); err != nil {
+		fmt.Println("Failed to send group message:", err)
+	}
+}
+
+// SendMessageToOtherDevices 把用户自己发出的消息同步到他的其他连接，跳过发出消息的那个连接
+func (m *WSManager) SendMessageToOtherDevices(userID, originConnectionID string, message models.Message) {
+	routes := m.locateAll([]string{userID})
+	if routes.empty() {
+		return
+	}
+
+	msg, err := marshalMessageView(message)
+	if err != nil {
+		fmt.Println("Error marshaling message:", err)
+		return
+	}
+	if err := m.deliver(routes, originConnectionID, msg); err != nil {
+		fmt.Println("Failed to echo message to", userID, ":", err)
+	}
+}
+
+// marshalMessageView 推送的消息与历史消息接口格式一致
+func marshalMessageView(message models.Message) ([]byte, error) {
+	return json.Marshal(BuildMessageViews([]models.Message{message})[0])
+}
+
 func (c *Client) StartHeartbeat() {
 	ticker := time.NewTicker(pingInterval)
 	defer ticker.Stop()
@@ -276,15 +434,3 @@ func (c *Client) CloseSendChannel() {
 		close(c.Send)
 	})
 }
-
-// 批量更新某个会话中 ID 小于等于指定 ID 的所有未读消息为已读
-func updateMessagesAsReadByID(conversationID string, maxID uint) error {
-	// 更新所有该会话中 ID 小于等于指定值且未读的消息为已读
-	fmt.Println(conversationID, maxID, 123123)
-	if err := config.DB.Model(&models.Message{}).
-		Where("conversation_id = ? AND is_read = false AND id <= ?", conversationID, maxID).
-		Update("is_read", true).Error; err != nil {
-		return fmt.Errorf("failed to update messages: %w", err)
-	}
-	return nil
-}
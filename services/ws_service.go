@@ -1,52 +1,78 @@
 package services
 
 import (
-	"chat-system/config"
 	"chat-system/models"
+	"errors"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
 )
 
+// wsTokenProtocol 浏览器无法自定义握手请求头时，可通过
+// Sec-WebSocket-Protocol: access_token, <jwt> 传递 token
+const wsTokenProtocol = "access_token"
+
 var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool { return true },
+	CheckOrigin:  func(r *http.Request) bool { return true },
+	Subprotocols: []string{wsTokenProtocol},
 }
 
 func HandleWebSocket(ctx *gin.Context) {
+	user, tokenID, authErr := authenticateWebSocket(ctx.Request)
+
 	conn, err := upgrader.Upgrade(ctx.Writer, ctx.Request, nil)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upgrade connection"})
 		return
 	}
 
-	client := &Client{
-		Conn:     conn,
-		Send:     make(chan []byte),
-		ID:       ctx.Query("user_id"),
-		LastPing: time.Now(), // 初始化心跳时间
+	// 鉴权失败：完成握手后立即以 1008（已登出的设备为 4001）关闭，浏览器端才能拿到明确的关闭码
+	if authErr != nil {
+		log.Println("WebSocket authentication failed:", authErr)
+		code := websocket.ClosePolicyViolation
+		if errors.Is(authErr, ErrTokenRevoked) {
+			code = CloseSignedOut // 设备已被登出，客户端不应再用原 token 重连
+		}
+		closeMsg := websocket.FormatCloseMessage(code, authErr.Error())
+		conn.WriteControl(websocket.CloseMessage, closeMsg, time.Now().Add(time.Second))
+		conn.Close()
+		return
 	}
 
+	client := newClient(conn, user, tokenID, ctx.Request)
+	saveConnection(client, ctx)
+
 	Manager.register <- client
 
 	go client.ReadMessages()
 	go client.WriteMessages()
+
+	// 握手时携带 last_message_id 则立即补发离线期间的消息
+	if lastMessageID, err := strconv.ParseUint(ctx.Query("last_message_id"), 10, 64); err == nil {
+		go client.syncMessages(uint(lastMessageID))
+	}
 }
 
-func getReceiverID(SenderID, ConversationID string) string {
-	var conversation models.Conversation
-	err := config.DB.Where("conversation_id = ?", ConversationID).First(&conversation).Error
-	if err != nil {
-		log.Println("Conversation not found:", err)
+// authenticateWebSocket 依次尝试 Authorization 头、Sec-WebSocket-Protocol 和一次性票据，返回用户和登录 token ID
+func authenticateWebSocket(r *http.Request) (*models.User, string, error) {
+	if authHeader := r.Header.Get("Authorization"); authHeader != "" {
+		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+		return AuthenticateToken(tokenString)
+	}
 
+	protocols := websocket.Subprotocols(r)
+	if len(protocols) == 2 && protocols[0] == wsTokenProtocol {
+		return AuthenticateToken(protocols[1])
 	}
-	ReceiverID := ""
-	if conversation.ParticipantA == SenderID {
-		ReceiverID = conversation.ParticipantB
-	} else {
-		ReceiverID = conversation.ParticipantA
+
+	if ticket := r.URL.Query().Get("ticket"); ticket != "" {
+		return consumeWSTicket(ticket)
 	}
-	return ReceiverID
+
+	return nil, "", errors.New("missing credentials")
 }
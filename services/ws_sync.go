@@ -0,0 +1,36 @@
+package services
+
+import (
+	"fmt"
+)
+
+const (
+	syncBatchSize  = 200 // 每批补发的消息数
+	syncMaxBatches = 10  // 单次同步最多连续推送的批数，超出后由客户端带游标继续
+)
+
+// syncMessages 从 lastMessageID 之后开始，按顺序补发用户在所有会话中错过的消息
+func (c *Client) syncMessages(lastMessageID uint) {
+	cursor := lastMessageID
+	for batch := 0; batch < syncMaxBatches; batch++ {
+		messages, err := GetMissedMessages(c.ID, cursor, syncBatchSize)
+		if err != nil {
+			fmt.Println("Failed to sync messages:", err)
+			return
+		}
+		if len(messages) > 0 {
+			cursor = messages[len(messages)-1].ID
+		}
+
+		// 最后一批不足 batch 大小说明已经追平；达到批数上限仍未追平时 has_more 为 true
+		caughtUp := len(messages) < syncBatchSize
+		hasMore := !caughtUp && batch == syncMaxBatches-1
+		if err := c.sendEvent(EventSync, SyncEvent{Messages: BuildMessageViews(messages), NextCursor: cursor, HasMore: hasMore}); err != nil {
+			fmt.Println("Failed to push sync batch:", err)
+			return
+		}
+		if caughtUp {
+			return
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package services
+
+import (
+	"chat-system/bus"
+	"chat-system/config"
+	"chat-system/models"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// wsTicketTTL 一次性票据的有效期，浏览器拿到后应立即发起 /ws 连接
+const wsTicketTTL = 30 * time.Second
+
+type wsTicket struct {
+	UserID  uint   `json:"user_id"`
+	TokenID string `json:"token_id"` // 签发票据时使用的登录 token，连接记录据此关联，登出设备时一并吊销
+}
+
+// wsTickets 票据存储，BUS_BACKEND=redis 时由 InitBus 换成各节点共享的 Redis 存储
+var wsTickets bus.TicketStore = bus.NewMemoryTicketStore()
+
+// IssueWSTicket 为已登录用户签发一个短期、只能使用一次的 WebSocket 握手票据
+func IssueWSTicket(user *models.User, tokenID string) (string, time.Time, error) {
+	ticket := uuid.New().String()
+	expiresAt := time.Now().Add(wsTicketTTL)
+
+	value, err := json.Marshal(wsTicket{UserID: user.ID, TokenID: tokenID})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	if err := wsTickets.Issue(ticket, value, wsTicketTTL); err != nil {
+		return "", time.Time{}, err
+	}
+	return ticket, expiresAt, nil
+}
+
+// consumeWSTicket 校验并作废票据，返回票据所属的用户和签发时使用的 token ID
+func consumeWSTicket(ticket string) (*models.User, string, error) {
+	value, err := wsTickets.Consume(ticket)
+	if errors.Is(err, bus.ErrTicketNotFound) {
+		return nil, "", errors.New("invalid or expired ticket")
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	var t wsTicket
+	if err := json.Unmarshal(value, &t); err != nil {
+		return nil, "", errors.New("invalid ticket")
+	}
+	// 票据签发后设备可能已被登出
+	if t.TokenID != "" && isTokenRevoked(t.TokenID) {
+		return nil, "", ErrTokenRevoked
+	}
+
+	var user models.User
+	if err := config.DB.First(&user, t.UserID).Error; err != nil {
+		return nil, "", errors.New("user not found")
+	}
+	return &user, t.TokenID, nil
+}
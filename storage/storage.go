@@ -0,0 +1,18 @@
+package storage
+
+import (
+	"errors"
+	"io"
+)
+
+var ErrInvalidKey = errors.New("invalid storage key")
+
+// Storage 可插拔的文件存储，key 为相对路径（如 "2024/05/<uuid>"）
+type Storage interface {
+	// Save 写入文件，已存在时覆盖
+	Save(key string, r io.Reader) error
+	// Open 读取文件，调用方负责关闭
+	Open(key string) (io.ReadCloser, error)
+	// Delete 删除文件，不存在时不报错
+	Delete(key string) error
+}
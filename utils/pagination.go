@@ -15,6 +15,12 @@ type Pagination struct {
 func GetPagination(c *gin.Context) Pagination {
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "10"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 10
+	}
 	return Pagination{
 		Page:     page,
 		PageSize: pageSize,
@@ -26,3 +32,32 @@ func (p *Pagination) Paginate() (offset int, limit int) {
 	limit = p.PageSize
 	return
 }
+
+const (
+	defaultCursorLimit = 50
+	maxCursorLimit     = 100
+)
+
+// CursorPagination 基于消息 ID 的游标分页（keyset），before / after 二选一
+type CursorPagination struct {
+	Before uint `json:"before,omitempty"` // 取 ID 小于 before 的更早记录
+	After  uint `json:"after,omitempty"`  // 取 ID 大于 after 的更新记录
+	Limit  int  `json:"limit"`
+}
+
+func GetCursorPagination(c *gin.Context) CursorPagination {
+	before, _ := strconv.ParseUint(c.Query("before"), 10, 64)
+	after, _ := strconv.ParseUint(c.Query("after"), 10, 64)
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultCursorLimit)))
+	if limit <= 0 {
+		limit = defaultCursorLimit
+	}
+	if limit > maxCursorLimit {
+		limit = maxCursorLimit
+	}
+	return CursorPagination{
+		Before: uint(before),
+		After:  uint(after),
+		Limit:  limit,
+	}
+}